@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes returned by the non-interactive CLI.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+// globalOptions holds the flags accepted before the task ID.
+type globalOptions struct {
+	TemplatePath string
+	TargetDir    string
+	ShowVersion  bool
+}
+
+// usageError marks errors caused by invalid command-line input.
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// parseGlobalFlags consumes the global flags and returns the remaining arguments.
+func parseGlobalFlags(args []string) (globalOptions, []string, error) {
+	var opts globalOptions
+
+	fs := flag.NewFlagSet("devtools", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.TemplatePath, "template", "", "path to the repository template")
+	fs.StringVar(&opts.TargetDir, "dir", "", "directory repositories are cloned into")
+	fs.BoolVar(&opts.ShowVersion, "version", false, "print the version and exit")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return opts, []string{"help"}, nil
+		}
+		return opts, nil, usagef("%v", err)
+	}
+
+	return opts, fs.Args(), nil
+}
+
+// runCLI resolves a task by ID and executes it (or one of its subcommands) without the menu.
+func runCLI(ctx context.Context, registry *TaskRegistry, args []string) int {
+	err := dispatch(ctx, registry, args)
+
+	var usageErr *usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "devtools: %s\n", redactSecrets(err.Error()))
+		fmt.Fprintln(os.Stderr, "Run 'devtools help' for usage.")
+		return exitUsage
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(os.Stderr, "devtools: interrupted")
+		return exitInterrupted
+	default:
+		fmt.Fprintf(os.Stderr, "devtools: %s\n", redactSecrets(err.Error()))
+		return exitFailure
+	}
+}
+
+func dispatch(ctx context.Context, registry *TaskRegistry, args []string) error {
+	if len(args) == 0 || args[0] == "help" {
+		if len(args) > 1 {
+			return dispatch(ctx, registry, []string{args[1], "--help"})
+		}
+		printUsage(os.Stdout, registry)
+		return nil
+	}
+
+	task := registry.FindTask(args[0])
+	if task == nil {
+		return usagef("unknown command %q", args[0])
+	}
+	rest := args[1:]
+
+	if flagTask, ok := task.(FlagTask); ok {
+		return flagTask.RunArgs(ctx, rest)
+	}
+
+	cmdTask, ok := task.(CommandTask)
+	if !ok {
+		if len(rest) > 0 {
+			if isHelpArg(rest[0]) {
+				printTaskUsage(os.Stdout, task)
+				return nil
+			}
+			return usagef("%s does not accept arguments", task.ID())
+		}
+		return task.Run(ctx)
+	}
+
+	if len(rest) == 0 {
+		printTaskUsage(os.Stderr, task)
+		return usagef("%s requires a subcommand", task.ID())
+	}
+	if isHelpArg(rest[0]) {
+		printTaskUsage(os.Stdout, task)
+		return nil
+	}
+
+	for _, sub := range cmdTask.Subcommands() {
+		if sub.Name == rest[0] {
+			return sub.Run(ctx, rest[1:])
+		}
+	}
+	return usagef("unknown %s subcommand %q", task.ID(), rest[0])
+}
+
+func isHelpArg(arg string) bool {
+	switch arg {
+	case "-h", "-help", "--help", "help":
+		return true
+	}
+	return false
+}
+
+// newCommandFlags builds a flag set for `devtools <path>` with consistent help output.
+func newCommandFlags(path, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: devtools %s [flags]\n\n%s\n", path, summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(fs.Output(), "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseCommandFlags parses subcommand flags, rejecting stray positional arguments.
+func parseCommandFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usagef("%s: %v", fs.Name(), err)
+	}
+	if fs.NArg() > 0 {
+		return usagef("%s: unexpected argument %q", fs.Name(), fs.Arg(0))
+	}
+	return nil
+}
+
+func printUsage(w io.Writer, registry *TaskRegistry) {
+	fmt.Fprintf(w, "DevTools (version %s)\n\n", displayVersion())
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, "  devtools                               start the interactive menu")
+	fmt.Fprintln(w, "  devtools [global flags] <command> [subcommand] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	fmt.Fprintln(w, "  --template PATH   repository template (default template.yml)")
+	fmt.Fprintln(w, "  --dir PATH        directory repositories are cloned into (default dev-app)")
+	fmt.Fprintln(w, "  --version         print the version and exit")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, task := range registry.GetTasks() {
+		fmt.Fprintf(tw, "  %s\t%s\n", task.ID(), task.Description())
+		if cmdTask, ok := task.(CommandTask); ok {
+			for _, sub := range cmdTask.Subcommands() {
+				fmt.Fprintf(tw, "  %s %s\t%s\n", task.ID(), sub.Name, sub.Summary)
+			}
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nRun 'devtools <command> --help' for details.")
+}
+
+func printTaskUsage(w io.Writer, task Task) {
+	cmdTask, ok := task.(CommandTask)
+	if !ok {
+		fmt.Fprintf(w, "Usage: devtools %s\n\n%s\n", task.ID(), task.Description())
+		return
+	}
+
+	fmt.Fprintf(w, "Usage: devtools %s <subcommand> [flags]\n\n%s\n\nSubcommands:\n", task.ID(), task.Description())
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, sub := range cmdTask.Subcommands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", sub.Name, sub.Summary)
+	}
+	tw.Flush()
+
+	names := make([]string, 0, len(cmdTask.Subcommands()))
+	for _, sub := range cmdTask.Subcommands() {
+		names = append(names, sub.Name)
+	}
+	fmt.Fprintf(w, "\nRun 'devtools %s <%s> --help' for flags.\n", task.ID(), strings.Join(names, "|"))
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// ComposeTask works with the Docker Compose stacks declared in the compose section of each
+// service: bringing them up and down, showing container state, tailing logs, and finding host
+// ports published by more than one stack.
+type ComposeTask struct {
+	workspaceConfig
+}
+
+// composePortCollision is a host port published by more than one compose project.
+type composePortCollision struct {
+	Port     int
+	Protocol string
+	Owners   []composePort
+}
+
+func (t *ComposeTask) ID() string {
+	return "compose"
+}
+
+func (t *ComposeTask) Name() string {
+	return "Compose Stacks"
+}
+
+func (t *ComposeTask) Description() string {
+	return "Bring service compose stacks up and down, show containers, tail logs and check ports"
+}
+
+func (t *ComposeTask) Run(ctx context.Context) error {
+	template, order, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+	names := composeServices(template, order)
+	if len(names) == 0 {
+		fmt.Println("No services in the template have a compose section.")
+		return nil
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Println("\n=== Compose Stacks ===")
+		fmt.Println("1. Show containers")
+		fmt.Println("2. Bring all stacks up")
+		fmt.Println("3. Take all stacks down")
+		fmt.Println("4. Show recent logs of a service")
+		fmt.Println("5. Check for port collisions")
+		fmt.Println("6. Back to main menu")
+		fmt.Print("\nSelect option: ")
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			return errors.New("input stream closed")
+		}
+
+		switch strings.TrimSpace(scanner.Text()) {
+		case "1":
+			err = t.ps(ctx, os.Stdout, template, names)
+		case "2":
+			err = t.up(ctx, template, names)
+		case "3":
+			err = t.down(ctx, template, names, false)
+		case "4":
+			name, ok := promptService(scanner, names, "Service")
+			if !ok {
+				continue
+			}
+			err = t.logs(ctx, template, []string{name}, false, "100")
+		case "5":
+			err = t.checkPorts(ctx, os.Stdout, template, names)
+		case "6":
+			return nil
+		default:
+			fmt.Println("Invalid option. Please try again.")
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Error: %s\n", redactSecrets(err.Error()))
+		}
+	}
+}
+
+// Subcommands exposes compose stack management to the CLI.
+func (t *ComposeTask) Subcommands() []Subcommand {
+	return []Subcommand{
+		{
+			Name:    "up",
+			Summary: "Start compose stacks in dependency order after checking for port collisions",
+			Run:     t.runUp,
+		},
+		{
+			Name:    "down",
+			Summary: "Stop and remove compose stacks in reverse dependency order",
+			Run:     t.runDown,
+		},
+		{
+			Name:    "ps",
+			Summary: "Show the containers of each compose stack",
+			Run:     t.runPS,
+		},
+		{
+			Name:    "logs",
+			Summary: "Show or follow compose stack logs",
+			Run:     t.runLogs,
+		},
+		{
+			Name:    "ports",
+			Summary: "Report host ports published by more than one compose stack",
+			Run:     t.runPorts,
+		},
+	}
+}
+
+func (t *ComposeTask) runUp(ctx context.Context, args []string) error {
+	fs := newCommandFlags("compose up", "Start the compose stacks of services in dependency order. Stacks are checked for host ports they would both publish first.")
+	service := fs.String("service", "", "start this service's stack and the stacks of its dependencies")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, names, err := t.loadSelection("up", *service)
+	if err != nil {
+		return err
+	}
+	return t.up(ctx, template, names)
+}
+
+func (t *ComposeTask) runDown(ctx context.Context, args []string) error {
+	fs := newCommandFlags("compose down", "Stop and remove the compose stacks of services, dependents first.")
+	service := fs.String("service", "", "take down this service's stack and the stacks of services that depend on it")
+	volumes := fs.Bool("volumes", false, "also remove named volumes declared by the stacks")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, names, err := t.loadSelection("down", *service)
+	if err != nil {
+		return err
+	}
+	return t.down(ctx, template, names, *volumes)
+}
+
+func (t *ComposeTask) runPS(ctx context.Context, args []string) error {
+	fs := newCommandFlags("compose ps", "Show every container of each service's compose stack with its state and published ports.")
+	service := fs.String("service", "", "show only this service's stack")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, names, err := t.loadSelection("ps", *service)
+	if err != nil {
+		return err
+	}
+	return t.ps(ctx, os.Stdout, template, names)
+}
+
+func (t *ComposeTask) runLogs(ctx context.Context, args []string) error {
+	fs := newCommandFlags("compose logs", "Show the logs of compose stacks, each line prefixed with its service. With --follow, keep streaming until interrupted.")
+	service := fs.String("service", "", "show only this service's stack")
+	follow := fs.Bool("follow", false, "keep streaming new log output")
+	tail := fs.String("tail", "", "number of lines to show from the end of each container's log (default all)")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, names, err := t.loadSelection("logs", *service)
+	if err != nil {
+		return err
+	}
+	return t.logs(ctx, template, names, *follow, *tail)
+}
+
+func (t *ComposeTask) runPorts(ctx context.Context, args []string) error {
+	fs := newCommandFlags("compose ports", "Read the host ports each compose stack publishes and report any published by more than one project. Exits non-zero when there is a collision.")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, names, err := t.loadSelection("ports", "")
+	if err != nil {
+		return err
+	}
+	return t.checkPorts(ctx, os.Stdout, template, names)
+}
+
+// loadSelection loads the template and the compose services a subcommand acts on. With a
+// service, up also includes its dependencies and down the services that depend on it.
+func (t *ComposeTask) loadSelection(verb, service string) (*repoTemplate, []string, error) {
+	template, order, err := t.loadTemplate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := order
+	if service != "" {
+		svc, ok := template.Services[service]
+		switch {
+		case !ok:
+			return nil, nil, usagef("compose %s: unknown service %q", verb, service)
+		case svc.Compose == nil:
+			return nil, nil, usagef("compose %s: service %q has no compose section", verb, service)
+		case verb == "up":
+			names, err = template.cloneListFor(service)
+		case verb == "down":
+			names, err = template.dependentsOf(service)
+		default:
+			names = []string{service}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	names = composeServices(template, names)
+	if len(names) == 0 {
+		return nil, nil, errors.New("no services in the template have a compose section")
+	}
+	return template, names, nil
+}
+
+// composeServices returns the names that have a compose section, keeping their order.
+func composeServices(template *repoTemplate, names []string) []string {
+	return slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+		return template.Services[name].Compose == nil
+	})
+}
+
+// up refuses to start when the stacks publish the same host port, then brings each cloned
+// stack up in order and waits for its health check. It stops at the first failure.
+func (t *ComposeTask) up(ctx context.Context, template *repoTemplate, names []string) (err error) {
+	console, finish := newRunOutput(os.Stdout, t.targetDir(), "compose-up")
+	defer func() { finish(err) }()
+	if err := t.savePorts(template); err != nil {
+		return err
+	}
+
+	collisions, err := t.collisions(ctx, template, names)
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		printPortCollisions(console, collisions)
+		return fmt.Errorf("%d host port(s) are published by more than one compose project; change one of them before starting", len(collisions))
+	}
+
+	for _, name := range names {
+		out := newServiceWriter(console, name)
+		err := t.eachCloned(out, template, name, func(repoPath string) error {
+			svc, err := template.withSecrets(name)
+			if err != nil {
+				return err
+			}
+			if err := runCompose(ctx, out, repoPath, name, svc, "up", "--detach"); err != nil {
+				return err
+			}
+			if svc.HealthCheck != nil {
+				return runHealthCheck(ctx, out, repoPath, name, svc.HealthCheck, svc.env())
+			}
+			return nil
+		})
+		out.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// down takes the stacks of names down in reverse order, continuing past failures.
+func (t *ComposeTask) down(ctx context.Context, template *repoTemplate, names []string, volumes bool) (err error) {
+	args := []string{"down"}
+	if volumes {
+		args = append(args, "--volumes")
+	}
+
+	console, finish := newRunOutput(os.Stdout, t.targetDir(), "compose-down")
+	defer func() { finish(err) }()
+	var failures []error
+	for _, name := range slices.Backward(names) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		out := newServiceWriter(console, name)
+		err := t.eachCloned(out, template, name, func(repoPath string) error {
+			svc, err := template.withSecrets(name)
+			if err != nil {
+				return err
+			}
+			return runCompose(ctx, out, repoPath, name, svc, args...)
+		})
+		out.Flush()
+		if err != nil {
+			failures = append(failures, err)
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d compose stack(s) failed to come down: %w", len(failures), errors.Join(failures...))
+	}
+	return nil
+}
+
+// eachCloned runs fn with the service's clone path, or notes that the service is not cloned.
+func (t *ComposeTask) eachCloned(out io.Writer, template *repoTemplate, name string, fn func(repoPath string) error) error {
+	repoPath, err := t.servicePath(template, name)
+	if err != nil {
+		return err
+	}
+	cloned, err := pathExists(repoPath)
+	switch {
+	case err != nil:
+		return fmt.Errorf("service %q: unable to inspect %s: %w", name, repoPath, err)
+	case !cloned:
+		fmt.Fprintln(out, "not cloned, skipping")
+		return nil
+	}
+	return fn(repoPath)
+}
+
+// ps prints one row per container of each stack. Services that are not cloned, or whose stack
+// cannot be queried, get a single row explaining why.
+func (t *ComposeTask) ps(ctx context.Context, w io.Writer, template *repoTemplate, names []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tCONTAINER\tSTATE\tPORTS")
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		repoPath, err := t.servicePath(template, name)
+		if err != nil {
+			return err
+		}
+		if cloned, err := pathExists(repoPath); err != nil || !cloned {
+			fmt.Fprintf(tw, "%s\t-\t%s\n", name, serviceNotCloned)
+			continue
+		}
+
+		containers, err := composeContainers(ctx, repoPath, name, template.Services[name])
+		switch {
+		case err != nil:
+			fmt.Fprintf(tw, "%s\t-\terror: %v\n", name, strings.TrimPrefix(err.Error(), fmt.Sprintf("service %q: ", name)))
+			continue
+		case len(containers) == 0:
+			fmt.Fprintf(tw, "%s\t-\tno containers\n", name)
+			continue
+		}
+		for _, c := range containers {
+			state := c.State
+			if c.Status != "" {
+				state = c.Status
+			}
+			if ports := c.ports(); ports != "" {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, c.Name, state, ports)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", name, c.Name, state)
+		}
+	}
+	return tw.Flush()
+}
+
+// logs streams the logs of each cloned stack at once, prefixing lines with the service name.
+func (t *ComposeTask) logs(ctx context.Context, template *repoTemplate, names []string, follow bool, tail string) error {
+	args := []string{"logs", "--no-color"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	if tail != "" {
+		args = append(args, "--tail", tail)
+	}
+
+	console := newSyncOutput(os.Stdout)
+	var wg sync.WaitGroup
+	errs := make([]error, len(names))
+	for i, name := range names {
+		out := newServiceWriter(console, name)
+		wg.Go(func() {
+			defer out.Flush()
+			errs[i] = t.eachCloned(out, template, name, func(repoPath string) error {
+				cmd := composeCommand(ctx, repoPath, template.Services[name], args...)
+				cmd.Stdout = out
+				cmd.Stderr = out
+				if err := cmd.Run(); err != nil && ctx.Err() == nil {
+					return fmt.Errorf("service %q: docker compose logs failed: %w", name, err)
+				}
+				return nil
+			})
+		})
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// checkPorts prints the host ports published by more than one stack and fails if there are any.
+func (t *ComposeTask) checkPorts(ctx context.Context, w io.Writer, template *repoTemplate, names []string) error {
+	collisions, err := t.collisions(ctx, template, names)
+	if err != nil {
+		return err
+	}
+	if len(collisions) == 0 {
+		fmt.Fprintf(w, "No port collisions between %d compose stack(s).\n", len(names))
+		return nil
+	}
+	printPortCollisions(w, collisions)
+	return fmt.Errorf("%d host port(s) are published by more than one compose project", len(collisions))
+}
+
+// collisions gathers the published ports of each cloned stack and groups those claimed by more
+// than one project. Ports shared within one project are left to compose itself.
+func (t *ComposeTask) collisions(ctx context.Context, template *repoTemplate, names []string) ([]composePortCollision, error) {
+	type portKey struct {
+		port     int
+		protocol string
+	}
+	owners := make(map[portKey][]composePort)
+	var order []portKey
+
+	for _, name := range names {
+		repoPath, err := t.servicePath(template, name)
+		if err != nil {
+			return nil, err
+		}
+		if cloned, err := pathExists(repoPath); err != nil || !cloned {
+			continue
+		}
+
+		ports, err := composePublishedPorts(ctx, repoPath, name, template.Services[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ports {
+			key := portKey{p.Port, p.Protocol}
+			if _, ok := owners[key]; !ok {
+				order = append(order, key)
+			}
+			owners[key] = append(owners[key], p)
+		}
+	}
+
+	var collisions []composePortCollision
+	for _, key := range order {
+		ports := owners[key]
+		projects := make(map[string]bool)
+		for _, p := range ports {
+			projects[p.Project] = true
+		}
+		if len(projects) > 1 {
+			collisions = append(collisions, composePortCollision{Port: key.port, Protocol: key.protocol, Owners: ports})
+		}
+	}
+	slices.SortFunc(collisions, func(a, b composePortCollision) int {
+		return a.Port - b.Port
+	})
+	return collisions, nil
+}
+
+func printPortCollisions(w io.Writer, collisions []composePortCollision) {
+	fmt.Fprintln(w, "Port collisions:")
+	for _, c := range collisions {
+		owners := make([]string, 0, len(c.Owners))
+		for _, p := range c.Owners {
+			owners = append(owners, fmt.Sprintf("%s (project %s)", p.Owner, p.Project))
+		}
+		fmt.Fprintf(w, "  %d/%s: %s\n", c.Port, c.Protocol, strings.Join(owners, ", "))
+	}
+}
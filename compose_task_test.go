@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// stackTemplate has three compose stacks, web depending on api depending on db, and a service
+// without one.
+const stackTemplate = `
+services:
+  db:
+    clone: { repo: https://example.com/db.git }
+    compose: { project: db }
+  api:
+    clone: { repo: https://example.com/api.git }
+    depends: [db]
+    compose: { project: api }
+  web:
+    clone: { repo: https://example.com/web.git }
+    depends: [api, tools]
+    compose: { project: web, files: [compose.yml] }
+  tools:
+    clone: { repo: https://example.com/tools.git }
+`
+
+func TestComposeUpAndDownOrder(t *testing.T) {
+	log := fakeDocker(t)
+	targetDir := t.TempDir()
+	for _, dir := range []string{"db", "api", "web", "tools"} {
+		writeClone(t, targetDir, dir, nil)
+	}
+	template := testTemplate(t, stackTemplate)
+	order, err := template.cloneOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := composeServices(template, order)
+	task := &ComposeTask{workspaceConfig{TargetDir: targetDir}}
+
+	if err := task.up(context.Background(), template, names); err != nil {
+		t.Fatal(err)
+	}
+	wantUp := []string{
+		"db compose -p db config --format json",
+		"api compose -p api config --format json",
+		"web compose -f compose.yml -p web config --format json",
+		"db compose -p db up --detach",
+		"api compose -p api up --detach",
+		"web compose -f compose.yml -p web up --detach",
+	}
+	if got := dockerCalls(t, log); !slices.Equal(got, wantUp) {
+		t.Errorf("up ran\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(wantUp, "\n"))
+	}
+
+	if err := task.down(context.Background(), template, names, true); err != nil {
+		t.Fatal(err)
+	}
+	wantDown := []string{
+		"web compose -f compose.yml -p web down --volumes",
+		"api compose -p api down --volumes",
+		"db compose -p db down --volumes",
+	}
+	if got := dockerCalls(t, log)[len(wantUp):]; !slices.Equal(got, wantDown) {
+		t.Errorf("down ran\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(wantDown, "\n"))
+	}
+}
+
+func TestComposeSkipsStacksNotCloned(t *testing.T) {
+	log := fakeDocker(t)
+	targetDir := t.TempDir()
+	writeClone(t, targetDir, "api", nil)
+	template := testTemplate(t, stackTemplate)
+	task := &ComposeTask{workspaceConfig{TargetDir: targetDir}}
+
+	if err := task.up(context.Background(), template, []string{"db", "api"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"api compose -p api config --format json",
+		"api compose -p api up --detach",
+	}
+	if got := dockerCalls(t, log); !slices.Equal(got, want) {
+		t.Errorf("up ran %q, want %q", got, want)
+	}
+}
+
+func TestComposePortCollisions(t *testing.T) {
+	log := fakeDocker(t)
+	targetDir := t.TempDir()
+	writeClone(t, targetDir, "db", map[string]string{
+		"config.json": `{"name": "db", "services": {
+  "postgres": {"ports": [{"target": 5432, "published": "5432"}]},
+  "admin": {"ports": [{"target": 80, "published": "8080"}]}
+}}`,
+	})
+	writeClone(t, targetDir, "api", map[string]string{
+		"config.json": `{"name": "api", "services": {
+  "app": {"ports": [{"target": 80, "published": "8080-8081"}]},
+  "proxy": {"ports": [{"target": 81, "published": "8081"}, {"target": 5432, "published": "5432", "protocol": "udp"}]}
+}}`,
+	})
+	template := testTemplate(t, stackTemplate)
+	task := &ComposeTask{workspaceConfig{TargetDir: targetDir}}
+	names := []string{"db", "api"}
+
+	collisions, err := task.collisions(context.Background(), template, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8081 is published twice within the api project, which compose reports itself, and 5432
+	// differs in protocol, so only 8080 collides.
+	if len(collisions) != 1 || collisions[0].Port != 8080 || collisions[0].Protocol != "tcp" {
+		t.Fatalf("collisions = %+v", collisions)
+	}
+	var owners []string
+	for _, p := range collisions[0].Owners {
+		owners = append(owners, p.Owner)
+	}
+	if want := []string{"db/admin", "api/app"}; !slices.Equal(owners, want) {
+		t.Errorf("owners = %q, want %q", owners, want)
+	}
+
+	var out bytes.Buffer
+	if err := task.checkPorts(context.Background(), &out, template, names); err == nil {
+		t.Error("checkPorts passed with a collision")
+	}
+	if want := "8080/tcp: db/admin (project db), api/app (project api)"; !strings.Contains(out.String(), want) {
+		t.Errorf("checkPorts printed %q, want it to contain %q", out.String(), want)
+	}
+
+	if err := task.up(context.Background(), template, names); err == nil {
+		t.Fatal("up started stacks that publish the same port")
+	}
+	for _, call := range dockerCalls(t, log) {
+		if strings.HasSuffix(call, " up --detach") {
+			t.Errorf("up ran %q despite the collision", call)
+		}
+	}
+}
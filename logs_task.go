@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// logPageLines is how many lines the built-in pager shows at a time.
+const logPageLines = 40
+
+// LogsTask shows the output that earlier runs kept in the workspace's run logs.
+type LogsTask struct {
+	workspaceConfig
+}
+
+func (t *LogsTask) ID() string {
+	return "logs"
+}
+
+func (t *LogsTask) Name() string {
+	return "View Last Run Logs"
+}
+
+func (t *LogsTask) Description() string {
+	return "Page through the output of recent clone, start, stop, compose and teardown runs"
+}
+
+func (t *LogsTask) Run(ctx context.Context) error {
+	root := runLogsDir(t.targetDir())
+	runs, err := listRunLogs(root)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Printf("No runs have been logged in %s yet.\n", root)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	run := runs[0]
+	for {
+		files, err := runLogFiles(filepath.Join(root, run))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n=== Run %s (%s) ===\n", run, runLogOutcome(filepath.Join(root, run)))
+		for i, file := range files {
+			fmt.Printf("%d. %s\n", i+1, file)
+		}
+		earlierOption := len(files) + 1
+		backOption := len(files) + 2
+		fmt.Printf("%d. Choose another run\n", earlierOption)
+		fmt.Printf("\n%d. Back to main menu\n", backOption)
+		fmt.Print("\nSelect option: ")
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			return errors.New("input stream closed")
+		}
+
+		choice, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		switch {
+		case err != nil:
+			fmt.Println("Please enter a valid number.")
+		case choice >= 1 && choice <= len(files):
+			if err := pageFile(scanner, filepath.Join(root, run, files[choice-1])); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case choice == earlierOption:
+			fmt.Println()
+			for i, name := range runs {
+				fmt.Printf("%d. %s (%s)\n", i+1, name, runLogOutcome(filepath.Join(root, name)))
+			}
+			if picked, ok := promptLine(scanner, "Run"); ok {
+				index, err := strconv.Atoi(picked)
+				if err != nil || index < 1 || index > len(runs) {
+					fmt.Println("Invalid option. Please try again.")
+					continue
+				}
+				run = runs[index-1]
+			}
+		case choice == backOption:
+			return nil
+		default:
+			fmt.Println("Invalid option. Please try again.")
+		}
+	}
+}
+
+// RunArgs prints a run log for scripts: the combined log of the last run unless a service or an
+// earlier run is chosen.
+func (t *LogsTask) RunArgs(ctx context.Context, args []string) error {
+	fs := newCommandFlags(t.ID(), "Print the log of the last run, or list the runs that were logged.")
+	service := fs.String("service", "", "print only this service's log")
+	run := fs.Int("run", 1, "which run to show, counting back from 1 for the most recent")
+	list := fs.Bool("list", false, "list the logged runs instead")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	root := runLogsDir(t.targetDir())
+	runs, err := listRunLogs(root)
+	if err != nil {
+		return err
+	}
+	if *list {
+		for i, name := range runs {
+			fmt.Printf("%d. %s (%s)\n", i+1, name, runLogOutcome(filepath.Join(root, name)))
+		}
+		return nil
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("no runs have been logged in %s yet", root)
+	}
+	if *run < 1 || *run > len(runs) {
+		return usagef("logs: --run must be between 1 and %d", len(runs))
+	}
+
+	file := combinedLogFile
+	if *service != "" {
+		file = logNameUnsafe.ReplaceAllString(*service, "-") + ".log"
+	}
+	f, err := os.Open(filepath.Join(root, runs[*run-1], file))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("service %q has no output in run %s", *service, runs[*run-1])
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
+// runLogFiles lists the logs of one run: the combined log first, then one per service.
+func runLogFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read run log: %w", err)
+	}
+	files := []string{combinedLogFile}
+	for _, entry := range entries {
+		if name := entry.Name(); name != combinedLogFile && strings.HasSuffix(name, ".log") {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// runLogOutcome summarises how a run ended from the last line of its combined log.
+func runLogOutcome(dir string) string {
+	contents, err := os.ReadFile(filepath.Join(dir, combinedLogFile))
+	if err != nil {
+		return "no log"
+	}
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+	// Lines start with a timestamp.
+	_, last, _ := strings.Cut(lines[len(lines)-1], " ")
+	switch {
+	case last == "finished ok":
+		return "ok"
+	case strings.HasPrefix(last, "failed: "):
+		return "failed"
+	}
+	return "did not finish"
+}
+
+// pageFile shows a log with $PAGER, or less when it is installed, falling back to showing
+// logPageLines lines at a time.
+func pageFile(scanner *bufio.Scanner, path string) error {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		if _, err := exec.LookPath("less"); err == nil {
+			pager = "less -R"
+		}
+	}
+	if pager != "" {
+		cmd := exec.Command("sh", "-c", pager+` "$1"`, "pager", path)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(string(contents), "\n")
+	for start := 0; start < len(lines); start += logPageLines {
+		end := min(start+logPageLines, len(lines))
+		fmt.Print(strings.Join(lines[start:end], ""))
+		if end == len(lines) {
+			break
+		}
+		fmt.Printf("-- %d/%d lines, Enter for more, q to stop -- ", end, len(lines))
+		if !scanner.Scan() || strings.TrimSpace(scanner.Text()) == "q" {
+			break
+		}
+	}
+	return nil
+}
@@ -10,6 +10,17 @@ import (
 )
 
 func main() {
+	opts, args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "devtools: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Run 'devtools help' for usage.")
+		os.Exit(exitUsage)
+	}
+	if opts.ShowVersion {
+		fmt.Println(displayVersion())
+		return
+	}
+
 	// Create context that handles graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -25,15 +36,31 @@ func main() {
 
 	// Create task registry and register available tasks
 	registry := NewTaskRegistry()
+	workspace := workspaceConfig{TemplatePath: opts.TemplatePath, TargetDir: opts.TargetDir}
 
 	// Register example tasks
 	registry.Register(&HelloWorldTask{})
 	registry.Register(&DependancyCheckTask{})
-	registry.Register(&ReposTask{})
+	registry.Register(&ReposTask{workspaceConfig: workspace})
 	registry.Register(&SSHKeyTask{})
-	registry.Register(&TemplateExportTask{})
+	registry.Register(&TemplateExportTask{TemplatePath: opts.TemplatePath})
+	registry.Register(&TemplateValidateTask{TemplatePath: opts.TemplatePath})
+	registry.Register(&WorkspaceStatusTask{workspaceConfig: workspace})
+	registry.Register(&WorktreeTask{workspaceConfig: workspace})
+	registry.Register(&ServicesTask{workspaceConfig: workspace})
+	registry.Register(&ComposeTask{workspaceConfig: workspace})
+	registry.Register(&TeardownTask{workspaceConfig: workspace})
+	registry.Register(&SecretsTask{workspaceConfig: workspace})
+	registry.Register(&LogsTask{workspaceConfig: workspace})
 	registry.Register(&SystemInfoTask{})
 
+	// Run a single command when arguments are given, otherwise fall back to the menu
+	if len(args) > 0 {
+		code := runCLI(ctx, registry, args)
+		cancel()
+		os.Exit(code)
+	}
+
 	// Create and display menu
 	menu := NewMenu(registry)
 	if err := menu.Display(ctx); err != nil {
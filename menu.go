@@ -71,7 +71,7 @@ func (m *Menu) Display(ctx context.Context) error {
 
 		fmt.Printf("\nExecuting: %s\n", task.Name())
 		if err := task.Run(ctx); err != nil {
-			fmt.Printf("Error running task: %v\n", err)
+			fmt.Printf("Error running task: %s\n", redactSecrets(err.Error()))
 		}
 
 		fmt.Println("\nPress Enter to continue...")
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -20,49 +22,338 @@ func ensureTargetDir(targetDir string) error {
 	return nil
 }
 
-// cloneServices iterates the requested services and clones each one in turn.
-func cloneServices(ctx context.Context, targetDir string, template *repoTemplate, names []string) error {
+const defaultCloneJobs = 4
+
+// cloneOptions controls how cloneServices schedules the requested services.
+type cloneOptions struct {
+	// Jobs caps how many services are provisioned at the same time.
+	Jobs int
+	// KeepGoing carries on with services that do not depend on a failure instead of stopping at the first one.
+	KeepGoing bool
+	// IgnorePortConflicts provisions even when declared ports clash or are already bound.
+	IgnorePortConflicts bool
+	// ReportDir is where the JSON and JUnit reports of the run are written; empty means the
+	// workspace's .devtools/reports directory.
+	ReportDir string
+}
+
+func (o cloneOptions) jobs() int {
+	if o.Jobs < 1 {
+		return 1
+	}
+	return o.Jobs
+}
+
+// cloneServices provisions the requested services, starting each one as soon as the
+// dependencies it shares with the request have finished, up to opts.Jobs at a time. The output
+// is kept in a run log in the workspace, and what happened to each service is written as JSON and
+// JUnit reports once the run ends, whether or not it succeeded.
+func cloneServices(ctx context.Context, targetDir string, template *repoTemplate, names []string, opts cloneOptions) (err error) {
 	if err := ensureTargetDir(targetDir); err != nil {
 		return fmt.Errorf("create target directory: %w", err)
 	}
+	console, finish := newRunOutput(os.Stdout, targetDir, "clone")
+	defer func() { finish(err) }()
 
-	for _, name := range names {
-		svc := template.Services[name]
-		repoPath, alreadyExists, err := cloneService(ctx, targetDir, name, svc.Clone)
-		if err != nil {
+	report := newCloneReport(targetDir, template, names)
+	if console.log != nil {
+		report.Logs = console.log.dir
+	}
+	defer func() {
+		report.finish(err)
+		dir := opts.ReportDir
+		if dir == "" {
+			dir = reportsDir(targetDir)
+		}
+		paths, writeErr := report.write(dir)
+		if writeErr != nil {
+			console.printf("warning: run report not written: %v\n", writeErr)
+			return
+		}
+		console.printf("Reports written to %s\n", strings.Join(paths, " and "))
+	}()
+
+	state, err := loadWorkspaceState(targetDir)
+	if err != nil {
+		return err
+	}
+	if err := template.ports.save(state); err != nil {
+		return err
+	}
+
+	if !opts.IgnorePortConflicts {
+		if err := checkPortConflicts(console, targetDir, state, template, names); err != nil {
 			return err
 		}
+	}
 
-		if len(svc.PostCloneCmds) == 0 || alreadyExists {
-			continue
+	requested := make(map[string]bool, len(names))
+	for _, name := range names {
+		requested[name] = true
+	}
+
+	// Only dependencies that are part of this request gate scheduling.
+	waitingOn := make(map[string]int, len(names))
+	dependents := make(map[string][]string, len(names))
+	for _, name := range names {
+		for _, dep := range template.Services[name].Depends {
+			dep = strings.TrimSpace(dep)
+			if !requested[dep] {
+				continue
+			}
+			waitingOn[name]++
+			dependents[dep] = append(dependents[dep], name)
 		}
+	}
 
-		if err := runPostCloneCommands(ctx, repoPath, name, svc.PostCloneCmds, svc.Environment); err != nil {
-			return err
+	queue := make([]string, 0, len(names))
+	for _, name := range names {
+		if waitingOn[name] == 0 {
+			queue = append(queue, name)
 		}
+	}
 
-		if svc.HealthCheck != nil {
-			if err := runHealthCheck(ctx, repoPath, name, svc.HealthCheck, svc.Environment); err != nil {
-				return err
+	type result struct {
+		name string
+		err  error
+	}
+
+	results := make(chan result)
+	running := 0
+	blocked := make(map[string]bool)
+	var failures []error
+
+	var skip func(name, failedDep string)
+	skip = func(name, failedDep string) {
+		if blocked[name] {
+			return
+		}
+		blocked[name] = true
+		reason := fmt.Sprintf("dependency %q did not complete", failedDep)
+		console.printf("[%s] skipped: %s\n", name, reason)
+		report.skip(name, reason)
+		for _, next := range dependents[name] {
+			skip(next, failedDep)
+		}
+	}
+
+	for {
+		stopping := ctx.Err() != nil || (len(failures) > 0 && !opts.KeepGoing)
+		for !stopping && running < opts.jobs() && len(queue) > 0 {
+			name := queue[0]
+			queue = queue[1:]
+			running++
+			go func(name string) {
+				out := newServiceWriter(console, name)
+				err := provisionService(ctx, out, state, targetDir, name, template, report.service(name))
+				out.Flush()
+				results <- result{name: name, err: err}
+			}(name)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+
+		if res.err != nil {
+			failures = append(failures, res.err)
+			for _, next := range dependents[res.name] {
+				skip(next, res.name)
 			}
+			continue
 		}
+
+		for _, next := range dependents[res.name] {
+			waitingOn[next]--
+			if waitingOn[next] == 0 && !blocked[next] {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d service(s) failed: %w", len(failures), errors.Join(failures...))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 	return nil
 }
 
-// cloneService executes a git clone command in the target directory, skipping work that already exists.
-func cloneService(ctx context.Context, targetDir, serviceName, cloneCmd string) (string, bool, error) {
-	fields := strings.Fields(cloneCmd)
+// provisionService clones a single service and, for fresh clones, writes its .env file and runs its
+// post-clone commands and health check.
+// Existing clones are only revisited when the run journal shows an earlier run stopped part way;
+// in that case provisioning resumes from the first post-clone command that has not succeeded.
+// Each step is recorded in report. Secrets are only looked up once something is going to run, so
+// a provisioned service needs none.
+func provisionService(ctx context.Context, out io.Writer, state *workspaceState, targetDir, name string, template *repoTemplate, report *serviceReport) (err error) {
+	report.start()
+	defer func() { report.finish(err) }()
+
+	started := time.Now()
+	repoPath, alreadyExists, err := cloneService(ctx, out, targetDir, name, template)
+	report.cloned(alreadyExists, time.Since(started), err)
+	if err != nil {
+		return err
+	}
+
+	svc := template.Services[name]
+	progress, tracked := state.service(name)
+	switch {
+	case !alreadyExists:
+		progress = serviceState{Cloned: true}
+		if err := state.update(name, func(entry *serviceState) { *entry = progress }); err != nil {
+			return err
+		}
+	case !tracked || progress.provisioned(svc):
+		return nil
+	}
+
+	// The journal holds commands as the template writes them, with ${secret:NAME} unresolved.
+	steps := postCloneSteps(svc.PostCloneCmds)
+	start := progress.resumeIndex(steps)
+	if svc.EnvFile != nil || start < len(steps) || svc.HealthCheck != nil {
+		if svc, err = template.withSecrets(name); err != nil {
+			return err
+		}
+	}
+	commands := postCloneSteps(svc.PostCloneCmds)
+	if len(commands) != len(steps) {
+		return fmt.Errorf("service %q: a post-clone command is empty once its secrets are filled in", name)
+	}
+
+	if svc.EnvFile != nil {
+		if err := writeServiceEnvFile(out, state, repoPath, name, svc, false); err != nil {
+			return err
+		}
+	}
+
+	report.doneEarlier(start)
+	switch {
+	case alreadyExists && start < len(steps):
+		fmt.Fprintf(out, "resuming provisioning at post-clone step %d/%d\n", start+1, len(steps))
+	case alreadyExists:
+		fmt.Fprintln(out, "post-clone commands already completed, resuming at health check")
+	}
+
+	if err := state.update(name, func(entry *serviceState) {
+		entry.PostClone = append([]string(nil), progress.PostClone[:start]...)
+		entry.Healthy = false
+	}); err != nil {
+		return err
+	}
+
+	// Commands run one at a time so the report can time each of them.
+	for i := start; i < len(steps); i++ {
+		started := time.Now()
+		err := runPostCloneCommands(ctx, out, repoPath, name, commands[i:i+1], svc.env(), nil)
+		report.commandRan(i, time.Since(started), err)
+		if err != nil {
+			return err
+		}
+		if err := state.update(name, func(entry *serviceState) {
+			entry.PostClone = append(entry.PostClone, steps[i])
+		}); err != nil {
+			return err
+		}
+	}
+
+	if svc.HealthCheck != nil {
+		err := pollHealthCheck(ctx, out, repoPath, name, svc.HealthCheck, svc.env(), report.healthAttempted)
+		report.healthChecked(err)
+		if err != nil {
+			return err
+		}
+	}
+	return state.update(name, func(entry *serviceState) { entry.Healthy = true })
+}
+
+// cloneService executes a git clone command in the target directory, checking out the service's
+// pinned branch, tag or commit, and skips work that already exists. The clone source may carry a
+// secret such as a token, so secrets are looked up only when a clone is going to run.
+func cloneService(ctx context.Context, out io.Writer, targetDir, serviceName string, template *repoTemplate) (string, bool, error) {
+	clone, err := parseCloneCommand(serviceName, template.Services[serviceName].Clone)
+	if err != nil {
+		return "", false, err
+	}
+
+	clonePath := filepath.Join(targetDir, clone.Dir)
+	if _, err := os.Stat(clonePath); err == nil {
+		fmt.Fprintf(out, "already exists at %s, skipping clone\n", clonePath)
+		return clonePath, true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", false, fmt.Errorf("service %q: unable to inspect %s: %w", serviceName, clonePath, err)
+	}
+
+	svc, err := template.withSecrets(serviceName)
+	if err != nil {
+		return "", false, err
+	}
+	if clone, err = parseCloneCommand(serviceName, svc.Clone); err != nil {
+		return "", false, err
+	}
+	pin, err := svc.pin()
+	if err != nil {
+		return "", false, fmt.Errorf("service %q: %w", serviceName, err)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "advice.detachedHead=false"}, clone.argsFor(pin)...)...)
+	cmd.Dir = targetDir
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	fmt.Fprintf(out, "cloning %s (%s) into %s\n", clone.RepoURL, pin, clonePath)
+	if err := cmd.Run(); err != nil {
+		return "", false, fmt.Errorf("service %q: clone failed: %w", serviceName, err)
+	}
+	if len(clone.Sparse) > 0 {
+		fmt.Fprintf(out, "limiting checkout to %s\n", strings.Join(clone.Sparse, ", "))
+		args := append([]string{"sparse-checkout", "set", "--cone", "--"}, clone.Sparse...)
+		if _, err := gitOutput(ctx, clonePath, args...); err != nil {
+			return "", false, fmt.Errorf("service %q: %w", serviceName, err)
+		}
+	}
+	if err := checkoutPin(ctx, out, clonePath, pin); err != nil {
+		return "", false, fmt.Errorf("service %q: %w", serviceName, err)
+	}
+
+	return clonePath, false, nil
+}
+
+// cloneCommand is a resolved clone spec: the git arguments to run and where the clone lands.
+type cloneCommand struct {
+	Args    []string
+	RepoURL string
+	Dir     string
+	Sparse  []string
+}
+
+// argsFor returns the git arguments that clone the repository checked out at pin.
+func (c cloneCommand) argsFor(pin revisionPin) []string {
+	args := append([]string{c.Args[0]}, pin.cloneArgs()...)
+	return append(args, c.Args[1:]...)
+}
+
+// parseCloneCommand validates a service's clone spec and resolves the directory it clones into.
+func parseCloneCommand(serviceName string, spec cloneSpec) (cloneCommand, error) {
+	if spec.Command == "" {
+		return structuredCloneCommand(serviceName, spec)
+	}
+
+	fields := strings.Fields(spec.Command)
 	if len(fields) < 3 {
-		return "", false, fmt.Errorf("service %q: clone command must look like 'git clone <repo> [dir]'", serviceName)
+		return cloneCommand{}, fmt.Errorf("service %q: clone command must look like 'git clone <repo> [dir]'", serviceName)
 	}
 	if fields[0] != "git" || fields[1] != "clone" {
-		return "", false, fmt.Errorf("service %q: clone command must start with 'git clone'", serviceName)
+		return cloneCommand{}, fmt.Errorf("service %q: clone command must start with 'git clone'", serviceName)
 	}
 
 	args := fields[2:]
 	if len(args) > 2 {
-		return "", false, fmt.Errorf("service %q: clone command only supports one optional target directory", serviceName)
+		return cloneCommand{}, fmt.Errorf("service %q: clone command only supports one optional target directory", serviceName)
 	}
 
 	repoURL := args[0]
@@ -73,34 +364,70 @@ func cloneService(ctx context.Context, targetDir, serviceName, cloneCmd string)
 
 	repoDir, err := deriveRepoDir(repoURL, explicitDir)
 	if err != nil {
-		return "", false, fmt.Errorf("service %q: %w", serviceName, err)
+		return cloneCommand{}, fmt.Errorf("service %q: %w", serviceName, err)
 	}
 
-	clonePath := filepath.Join(targetDir, repoDir)
-	if _, err := os.Stat(clonePath); err == nil {
-		fmt.Printf("[%s] already exists at %s, skipping clone\n", serviceName, clonePath)
-		return clonePath, true, nil
-	} else if !errors.Is(err, os.ErrNotExist) {
-		return "", false, fmt.Errorf("service %q: unable to inspect %s: %w", serviceName, clonePath, err)
+	return cloneCommand{Args: fields[1:], RepoURL: repoURL, Dir: repoDir}, nil
+}
+
+// structuredCloneCommand builds the git arguments for the mapping form of a clone spec.
+func structuredCloneCommand(serviceName string, spec cloneSpec) (cloneCommand, error) {
+	repoURL := strings.TrimSpace(spec.Repo)
+	if repoURL == "" {
+		return cloneCommand{}, fmt.Errorf("service %q: clone repo is required", serviceName)
+	}
+	if spec.Depth < 0 {
+		return cloneCommand{}, fmt.Errorf("service %q: clone depth must not be negative", serviceName)
 	}
 
-	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
-	cmd.Dir = targetDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	sparse := make([]string, 0, len(spec.Sparse))
+	for _, path := range spec.Sparse {
+		path = strings.Trim(strings.TrimSpace(path), "/")
+		switch {
+		case path == "":
+			return cloneCommand{}, fmt.Errorf("service %q: clone sparse paths must not be empty", serviceName)
+		case strings.ContainsAny(path, "*?[!\\"):
+			return cloneCommand{}, fmt.Errorf("service %q: clone sparse path %q must be a plain directory, not a pattern", serviceName, path)
+		case slices.Contains(strings.Split(path, "/"), ".."):
+			return cloneCommand{}, fmt.Errorf("service %q: clone sparse path %q must stay inside the repository", serviceName, path)
+		}
+		sparse = append(sparse, path)
+	}
 
-	fmt.Printf("[%s] cloning %s into %s\n", serviceName, repoURL, clonePath)
-	if err := cmd.Run(); err != nil {
-		return "", false, fmt.Errorf("service %q: clone failed: %w", serviceName, err)
+	repoDir, err := deriveRepoDir(repoURL, strings.TrimSpace(spec.Dir))
+	if err != nil {
+		return cloneCommand{}, fmt.Errorf("service %q: %w", serviceName, err)
 	}
 
-	return clonePath, false, nil
+	args := []string{"clone"}
+	if spec.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(spec.Depth))
+	}
+	if filter := strings.TrimSpace(spec.Filter); filter != "" {
+		args = append(args, "--filter="+filter)
+	}
+	if spec.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if spec.Submodules {
+		args = append(args, "--recurse-submodules")
+	}
+	if len(sparse) > 0 {
+		args = append(args, "--sparse")
+	}
+	args = append(args, "--", repoURL, repoDir)
+
+	return cloneCommand{Args: args, RepoURL: repoURL, Dir: repoDir, Sparse: sparse}, nil
 }
 
-// deriveRepoDir determines the local directory name for a repository.
+// deriveRepoDir determines the local directory name for a repository. The directory is always a
+// single name inside the workspace, so clone, update, worktree and teardown never reach outside it.
 func deriveRepoDir(repoURL, explicitDir string) (string, error) {
 	if explicitDir != "" {
-		return explicitDir, nil
+		if !isWorkspacePath(explicitDir) {
+			return "", fmt.Errorf("clone dir %q must be a relative path inside the workspace", explicitDir)
+		}
+		return filepath.Clean(explicitDir), nil
 	}
 
 	repoURL = strings.TrimSpace(repoURL)
@@ -112,16 +439,29 @@ func deriveRepoDir(repoURL, explicitDir string) (string, error) {
 	name = strings.TrimSuffix(name, ".git")
 	name = strings.TrimSuffix(name, string(filepath.Separator))
 
-	if name == "" || name == "." || name == string(filepath.Separator) {
+	if !isWorkspacePath(name) {
 		return "", fmt.Errorf("unable to determine repository directory from %q", repoURL)
 	}
 
 	return name, nil
 }
 
+// isWorkspacePath reports whether dir, such as "api" or "services/api", stays below the directory
+// it is joined to: not empty, absolute, the directory itself or escaping it through "..".
+func isWorkspacePath(dir string) bool {
+	return filepath.IsLocal(dir) && filepath.Clean(dir) != "."
+}
+
 // runPostCloneCommands executes post-clone commands inside the freshly cloned repository.
-func runPostCloneCommands(ctx context.Context, repoPath, serviceName string, commands []string, envDefaults map[string]string) error {
-	env := mergedEnv(envDefaults)
+// completed, when non-nil, is called after each command succeeds.
+func runPostCloneCommands(ctx context.Context, out io.Writer, repoPath, serviceName string, commands []string, env serviceEnv, completed func(command string) error) error {
+	return runServiceCommands(ctx, out, repoPath, serviceName, "post-clone", commands, env, completed)
+}
+
+// runServiceCommands executes a list of template commands through bash inside repoPath with the
+// service's environment applied, stopping at the first failure. stage names the list in output.
+func runServiceCommands(ctx context.Context, out io.Writer, repoPath, serviceName, stage string, commands []string, env serviceEnv, completed func(command string) error) error {
+	environ := mergedEnv(env)
 
 	for _, raw := range commands {
 		raw = strings.TrimSpace(raw)
@@ -129,108 +469,34 @@ func runPostCloneCommands(ctx context.Context, repoPath, serviceName string, com
 			continue
 		}
 
-		fmt.Printf("[%s] post-clone: %s\n", serviceName, raw)
+		fmt.Fprintf(out, "%s: %s\n", stage, raw)
 		cmd := exec.CommandContext(ctx, "bash", "-lc", raw)
 		cmd.Dir = repoPath
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Env = env
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.Env = environ
 
 		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("service %q: post-clone command failed (%s): %w", serviceName, raw, err)
+			return fmt.Errorf("service %q: %s command failed (%s): %w", serviceName, stage, raw, err)
 		}
-	}
-	return nil
-}
 
-func mergedEnv(defaults map[string]string) []string {
-	values := map[string]string{}
-	for _, kv := range os.Environ() {
-		parts := strings.SplitN(kv, "=", 2)
-		key := parts[0]
-		val := ""
-		if len(parts) == 2 {
-			val = parts[1]
-		}
-		values[key] = val
-	}
-
-	for key, val := range defaults {
-		if val == "" {
-			continue
-		}
-		if existing, ok := values[key]; !ok || existing == "" {
-			values[key] = val
+		if completed != nil {
+			if err := completed(raw); err != nil {
+				return err
+			}
 		}
 	}
-
-	keys := make([]string, 0, len(values))
-	for k := range values {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	result := make([]string, 0, len(keys))
-	for _, k := range keys {
-		result = append(result, fmt.Sprintf("%s=%s", k, values[k]))
-	}
-	return result
+	return nil
 }
 
-func runHealthCheck(ctx context.Context, repoPath, serviceName string, cfg *serviceHealth, envDefaults map[string]string) error {
-	command := strings.TrimSpace(cfg.Command)
-	if command == "" {
-		return nil
-	}
-
-	retries := cfg.Retries
-	if retries <= 0 {
-		retries = 5
-	}
-
-	interval := time.Second * 5
-	if cfg.Interval != "" {
-		if parsed, err := time.ParseDuration(cfg.Interval); err == nil {
-			interval = parsed
-		}
-	}
-
-	var timeout time.Duration
-	if cfg.Timeout != "" {
-		if parsed, err := time.ParseDuration(cfg.Timeout); err == nil {
-			timeout = parsed
-		}
-	}
-
-	env := mergedEnv(envDefaults)
-
-	for attempt := 1; attempt <= retries; attempt++ {
-		fmt.Printf("[%s] health check attempt %d/%d: %s\n", serviceName, attempt, retries, command)
-
-		runCtx := ctx
-		cancel := func() {}
-		if timeout > 0 {
-			runCtx, cancel = context.WithTimeout(ctx, timeout)
-		}
-
-		cmd := exec.CommandContext(runCtx, "bash", "-lc", command)
-		cmd.Dir = repoPath
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Env = env
-
-		err := cmd.Run()
-		cancel()
-
-		if err == nil {
-			fmt.Printf("[%s] health check passed\n", serviceName)
-			return nil
-		}
-
-		if attempt < retries {
-			time.Sleep(interval)
+// postCloneSteps returns the non-blank post-clone commands, trimmed, in template order.
+func postCloneSteps(commands []string) []string {
+	steps := make([]string, 0, len(commands))
+	for _, raw := range commands {
+		raw = strings.TrimSpace(raw)
+		if raw != "" {
+			steps = append(steps, raw)
 		}
 	}
-
-	return fmt.Errorf("service %q: health check failed after %d attempt(s)", serviceName, retries)
+	return steps
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretTemplate is testTemplate with ${secret:NAME} references bound to the template's secret
+// providers, as workspaceConfig.bindTemplate binds them.
+func secretTemplate(t *testing.T, text string) *repoTemplate {
+	t.Helper()
+	var template repoTemplate
+	if err := yaml.Unmarshal([]byte(text), &template); err != nil {
+		t.Fatal(err)
+	}
+	template.secrets = newSecretResolver(template.Secrets).resolve
+	if err := template.render(); err != nil {
+		t.Fatal(err)
+	}
+	return &template
+}
+
+func TestProvisionLooksUpSecretsOnlyWhenSomethingRuns(t *testing.T) {
+	const text = `
+secrets:
+  providers:
+    - type: env
+services:
+  api:
+    clone: { repo: https://example.com/api.git }
+    environment:
+      TOKEN: ${secret:api/token}
+    postCloneCmds:
+      - echo "$TOKEN" > token.txt
+`
+	const step = `echo "$TOKEN" > token.txt`
+
+	for _, tc := range []struct {
+		name      string
+		journal   serviceState
+		secret    string
+		wantErr   string
+		wantToken string
+	}{
+		{"provisioned without a secret", serviceState{Cloned: true, PostClone: []string{step}, Healthy: true}, "", "", ""},
+		{"pending without a secret", serviceState{Cloned: true}, "", `secret "api/token" not found`, ""},
+		{"pending with a secret", serviceState{Cloned: true}, "s3cret", "", "s3cret\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("DEVTOOLS_SECRET_API_TOKEN", tc.secret)
+			if tc.secret == "" {
+				os.Unsetenv("DEVTOOLS_SECRET_API_TOKEN")
+			}
+			targetDir := t.TempDir()
+			repoPath := writeClone(t, targetDir, "api", nil)
+			state, err := loadWorkspaceState(targetDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := state.update("api", func(entry *serviceState) { *entry = tc.journal }); err != nil {
+				t.Fatal(err)
+			}
+
+			template := secretTemplate(t, text)
+			err = cloneServices(context.Background(), targetDir, template, []string{"api"}, cloneOptions{IgnorePortConflicts: true})
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("clone failed: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("err = %v, want it to contain %q", err, tc.wantErr)
+			}
+
+			token, _ := os.ReadFile(filepath.Join(repoPath, "token.txt"))
+			if string(token) != tc.wantToken {
+				t.Errorf("token.txt = %q, want %q", token, tc.wantToken)
+			}
+			if tc.wantToken == "" {
+				return
+			}
+			state, err = loadWorkspaceState(targetDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if progress, _ := state.service("api"); !slices.Equal(progress.PostClone, []string{step}) {
+				t.Errorf("journal recorded %q, want the command as written", progress.PostClone)
+			}
+		})
+	}
+}
+
+func TestParseCloneCommandDir(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		spec    cloneSpec
+		wantDir string
+		wantErr bool
+	}{
+		{"derived from the URL", cloneSpec{Command: "git clone git@example.com:team/api.git"}, "api", false},
+		{"legacy nested dir", cloneSpec{Command: "git clone git@example.com:team/api.git services/api"}, filepath.Join("services", "api"), false},
+		{"nested dir is cleaned", cloneSpec{Repo: "https://example.com/api.git", Dir: "services/./api/"}, filepath.Join("services", "api"), false},
+		{"absolute dir", cloneSpec{Command: "git clone git@example.com:team/api.git /tmp/api"}, "", true},
+		{"escaping dir", cloneSpec{Repo: "https://example.com/api.git", Dir: "services/../../api"}, "", true},
+		{"workspace itself", cloneSpec{Repo: "https://example.com/api.git", Dir: "services/.."}, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clone, err := parseCloneCommand("api", tc.spec)
+			switch {
+			case tc.wantErr && err == nil:
+				t.Fatalf("dir %q was accepted", clone.Dir)
+			case !tc.wantErr && err != nil:
+				t.Fatal(err)
+			case clone.Dir != tc.wantDir:
+				t.Errorf("dir = %q, want %q", clone.Dir, tc.wantDir)
+			}
+		})
+	}
+}
+
+func TestCloneServicesOrder(t *testing.T) {
+	const text = `
+services:
+  db:
+    clone: { repo: https://example.com/db.git }
+    postCloneCmds: [%s]
+  api:
+    clone: { repo: https://example.com/api.git }
+    depends: [db]
+    postCloneCmds: [echo api >> %[2]s]
+  web:
+    clone: { repo: https://example.com/web.git }
+    depends: [api]
+    postCloneCmds: [echo web >> %[2]s]
+  worker:
+    clone: { repo: https://example.com/worker.git }
+    postCloneCmds: [echo worker >> %[2]s]
+`
+	for _, tc := range []struct {
+		name      string
+		dbCommand string
+		keepGoing bool
+		want      []string
+		wantErr   bool
+	}{
+		{"dependencies run first", "echo db >> %s", false, []string{"db", "worker", "api", "web"}, false},
+		{"a failure stops the run", "exit 1", false, nil, true},
+		{"keep going skips only dependents", "exit 1", true, []string{"worker"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Commands run in a login shell; an empty home keeps the user's profile out of it.
+			t.Setenv("HOME", t.TempDir())
+			targetDir := t.TempDir()
+			logPath := filepath.Join(t.TempDir(), "order.log")
+			state, err := loadWorkspaceState(targetDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{"web", "api", "db", "worker"}
+			for _, name := range names {
+				writeClone(t, targetDir, name, nil)
+				if err := state.update(name, func(entry *serviceState) { entry.Cloned = true }); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			dbCommand := tc.dbCommand
+			if strings.Contains(dbCommand, "%s") {
+				dbCommand = fmt.Sprintf(dbCommand, logPath)
+			}
+			template := testTemplate(t, fmt.Sprintf(text, dbCommand, logPath))
+			err = cloneServices(context.Background(), targetDir, template, names, cloneOptions{Jobs: 1, KeepGoing: tc.keepGoing, IgnorePortConflicts: true})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want an error: %v", err, tc.wantErr)
+			}
+
+			contents, _ := os.ReadFile(logPath)
+			if got := strings.Fields(string(contents)); !slices.Equal(got, tc.want) {
+				t.Errorf("ran %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// composeProjectPattern matches the project names Docker Compose accepts.
+var composeProjectPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// composeConfig describes the Docker Compose stack that belongs to a service. Files and Profiles
+// map to `docker compose -f` and `--profile`; Project overrides the project name, which
+// otherwise defaults to the clone's directory name.
+type composeConfig struct {
+	Files    []string `yaml:"files,omitempty"`
+	Project  string   `yaml:"project,omitempty"`
+	Profiles []string `yaml:"profiles,omitempty"`
+}
+
+// args returns the `docker compose` arguments selecting this stack, followed by extra.
+func (c *composeConfig) args(extra ...string) []string {
+	args := []string{"compose"}
+	for _, file := range c.Files {
+		args = append(args, "-f", file)
+	}
+	if c.Project != "" {
+		args = append(args, "-p", c.Project)
+	}
+	for _, profile := range c.Profiles {
+		args = append(args, "--profile", profile)
+	}
+	return append(args, extra...)
+}
+
+// composeCommand prepares `docker compose` for svc inside its clone, with the service's
+// environment applied so variable substitution in compose files sees template values.
+func composeCommand(ctx context.Context, repoPath string, svc repoService, extra ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "docker", svc.Compose.args(extra...)...)
+	cmd.Dir = repoPath
+	cmd.Env = mergedEnv(svc.env())
+	return cmd
+}
+
+// runCompose runs a compose command for svc, streaming its output to out.
+func runCompose(ctx context.Context, out io.Writer, repoPath, name string, svc repoService, extra ...string) error {
+	cmd := composeCommand(ctx, repoPath, svc, extra...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	fmt.Fprintf(out, "docker %s\n", strings.Join(cmd.Args[1:], " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("service %q: docker compose %s failed: %w", name, strings.Join(extra, " "), err)
+	}
+	return nil
+}
+
+// composeOutput runs a compose command for svc and returns its stdout.
+func composeOutput(ctx context.Context, repoPath, name string, svc repoService, extra ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := composeCommand(ctx, repoPath, svc, extra...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("service %q: docker compose %s: %s", name, strings.Join(extra, " "), msg)
+		}
+		return nil, fmt.Errorf("service %q: docker compose %s: %w", name, strings.Join(extra, " "), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// composeContainer is one container reported by `docker compose ps --format json`.
+type composeContainer struct {
+	Name       string             `json:"Name"`
+	Service    string             `json:"Service"`
+	State      string             `json:"State"`
+	Status     string             `json:"Status"`
+	Publishers []composePublisher `json:"Publishers"`
+}
+
+type composePublisher struct {
+	URL           string `json:"URL"`
+	TargetPort    int    `json:"TargetPort"`
+	PublishedPort int    `json:"PublishedPort"`
+	Protocol      string `json:"Protocol"`
+}
+
+// ports renders the published ports of a container, e.g. "8080->80/tcp".
+func (c composeContainer) ports() string {
+	var ports []string
+	// Compose lists a published port once per IP family, hence the Compact below.
+	for _, p := range c.Publishers {
+		if p.PublishedPort == 0 {
+			continue
+		}
+		ports = append(ports, fmt.Sprintf("%d->%d/%s", p.PublishedPort, p.TargetPort, p.Protocol))
+	}
+	return strings.Join(slices.Compact(ports), ", ")
+}
+
+// composeContainers lists the containers of svc's stack, stopped ones included.
+func composeContainers(ctx context.Context, repoPath, name string, svc repoService) ([]composeContainer, error) {
+	out, err := composeOutput(ctx, repoPath, name, svc, "ps", "--all", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parseComposePS(out)
+}
+
+// parseComposePS accepts both output styles of `docker compose ps --format json`: a JSON array
+// (Compose before 2.21) or one JSON object per line.
+func parseComposePS(out []byte) ([]composeContainer, error) {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	var containers []composeContainer
+	if out[0] == '[' {
+		if err := json.Unmarshal(out, &containers); err != nil {
+			return nil, fmt.Errorf("parse docker compose ps output: %w", err)
+		}
+		return containers, nil
+	}
+
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		var c composeContainer
+		if err := json.Unmarshal(line, &c); err != nil {
+			return nil, fmt.Errorf("parse docker compose ps output: %w", err)
+		}
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+// composePort is a host port a compose stack publishes.
+type composePort struct {
+	Port     int
+	Protocol string
+	// Owner is "<template service>/<compose service>".
+	Owner   string
+	Project string
+}
+
+// composePublishedPorts reads the host ports svc's stack publishes from `docker compose config`,
+// so collisions are found before anything is started.
+func composePublishedPorts(ctx context.Context, repoPath, name string, svc repoService) ([]composePort, error) {
+	out, err := composeOutput(ctx, repoPath, name, svc, "config", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Name     string `json:"name"`
+		Services map[string]struct {
+			Ports []struct {
+				Published json.RawMessage `json:"published"`
+				Protocol  string          `json:"protocol"`
+			} `json:"ports"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, fmt.Errorf("service %q: parse docker compose config output: %w", name, err)
+	}
+
+	var ports []composePort
+	for composeService, def := range config.Services {
+		for _, p := range def.Ports {
+			published, err := parsePublishedPorts(p.Published)
+			if err != nil {
+				return nil, fmt.Errorf("service %q: compose service %s: %w", name, composeService, err)
+			}
+			protocol := p.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			for _, port := range published {
+				ports = append(ports, composePort{
+					Port:     port,
+					Protocol: protocol,
+					Owner:    name + "/" + composeService,
+					Project:  config.Name,
+				})
+			}
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		return ports[i].Owner < ports[j].Owner
+	})
+	return ports, nil
+}
+
+// parsePublishedPorts decodes a compose "published" value: absent, a number, or a string holding
+// a port or a range such as "8080-8082".
+func parsePublishedPorts(raw json.RawMessage) ([]int, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("unexpected published port %s", raw)
+		}
+		return []int{n}, nil
+	}
+	if text == "" {
+		return nil, nil
+	}
+
+	lowText, highText, isRange := strings.Cut(text, "-")
+	low, err := strconv.Atoi(lowText)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected published port %q", text)
+	}
+	if !isRange {
+		return []int{low}, nil
+	}
+	high, err := strconv.Atoi(highText)
+	if err != nil || high < low {
+		return nil, fmt.Errorf("unexpected published port range %q", text)
+	}
+
+	ports := make([]int, 0, high-low+1)
+	for port := low; port <= high; port++ {
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fakeDockerScript stands in for docker. It appends "<clone dir> <args>" to $FAKE_DOCKER_LOG and
+// answers `compose ps` and `compose config` from ps.json and config.json in the clone, if present.
+const fakeDockerScript = `#!/bin/sh
+echo "$(basename "$PWD") $*" >> "$FAKE_DOCKER_LOG"
+case " $* " in
+*" ps "*) cat ps.json 2>/dev/null || true ;;
+*" config "*) cat config.json 2>/dev/null || echo '{}' ;;
+esac
+`
+
+// fakeDocker puts fakeDockerScript first on PATH and returns the file it logs its invocations to.
+func fakeDocker(t *testing.T) string {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(fakeDockerScript), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(bin, "docker.log")
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_DOCKER_LOG", log)
+	return log
+}
+
+// dockerCalls returns the invocations fakeDocker logged, one "<clone dir> <args>" per call.
+func dockerCalls(t *testing.T, log string) []string {
+	t.Helper()
+	contents, err := os.ReadFile(log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(contents)), "\n")
+}
+
+// testTemplate decodes and renders a template written inline.
+func testTemplate(t *testing.T, text string) *repoTemplate {
+	t.Helper()
+	var template repoTemplate
+	if err := yaml.Unmarshal([]byte(text), &template); err != nil {
+		t.Fatal(err)
+	}
+	if err := template.render(); err != nil {
+		t.Fatal(err)
+	}
+	return &template
+}
+
+// writeClone creates a service's clone directory in targetDir with the given files.
+func writeClone(t *testing.T, targetDir, dir string, files map[string]string) string {
+	t.Helper()
+	repoPath := filepath.Join(targetDir, dir)
+	if err := os.MkdirAll(repoPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repoPath
+}
+
+func TestParseComposePS(t *testing.T) {
+	array := `[{"Name":"app-web-1","Service":"web","State":"running","Publishers":[{"URL":"0.0.0.0","TargetPort":80,"PublishedPort":8080,"Protocol":"tcp"}]}]`
+	lines := `{"Name":"app-web-1","Service":"web","State":"running","Publishers":[{"URL":"0.0.0.0","TargetPort":80,"PublishedPort":8080,"Protocol":"tcp"},{"URL":"::","TargetPort":80,"PublishedPort":8080,"Protocol":"tcp"}]}
+{"Name":"app-db-1","Service":"db","State":"exited","Publishers":[{"TargetPort":5432,"PublishedPort":0,"Protocol":"tcp"}]}
+`
+	for _, tc := range []struct {
+		name  string
+		out   string
+		want  []string
+		ports []string
+	}{
+		{"empty", "  \n", nil, nil},
+		{"array", array, []string{"app-web-1 running"}, []string{"8080->80/tcp"}},
+		{"lines", lines, []string{"app-web-1 running", "app-db-1 exited"}, []string{"8080->80/tcp", ""}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			containers, err := parseComposePS([]byte(tc.out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, ports []string
+			for _, c := range containers {
+				got = append(got, c.Name+" "+c.State)
+				ports = append(ports, c.ports())
+			}
+			if !slices.Equal(got, tc.want) || !slices.Equal(ports, tc.ports) {
+				t.Errorf("got %q with ports %q, want %q with ports %q", got, ports, tc.want, tc.ports)
+			}
+		})
+	}
+
+	if _, err := parseComposePS([]byte("{not json")); err == nil {
+		t.Error("malformed output was accepted")
+	}
+}
+
+func TestComposeContainers(t *testing.T) {
+	log := fakeDocker(t)
+	targetDir := t.TempDir()
+	template := testTemplate(t, `
+services:
+  app:
+    clone: { repo: https://example.com/app.git }
+    compose: { files: [compose.yml, compose.dev.yml], project: app, profiles: [debug] }
+`)
+	repoPath := writeClone(t, targetDir, "app", map[string]string{
+		"ps.json": `{"Name":"app-web-1","Service":"web","State":"running"}` + "\n",
+	})
+
+	containers, err := composeContainers(context.Background(), repoPath, "app", template.Services["app"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Service != "web" || containers[0].State != "running" {
+		t.Errorf("containers = %+v", containers)
+	}
+
+	want := []string{"app compose -f compose.yml -f compose.dev.yml -p app --profile debug ps --all --format json"}
+	if got := dockerCalls(t, log); !slices.Equal(got, want) {
+		t.Errorf("docker calls = %q, want %q", got, want)
+	}
+}
+
+func TestComposePublishedPorts(t *testing.T) {
+	fakeDocker(t)
+	targetDir := t.TempDir()
+	template := testTemplate(t, `
+services:
+  app:
+    clone: { repo: https://example.com/app.git }
+    compose: {}
+`)
+	repoPath := writeClone(t, targetDir, "app", map[string]string{
+		"config.json": `{
+  "name": "app",
+  "services": {
+    "web": {"ports": [{"target": 80, "published": "8080", "protocol": "tcp"}, {"target": 443, "published": "8443-8444"}]},
+    "dns": {"ports": [{"target": 53, "published": 5353, "protocol": "udp"}, {"target": 9000}]}
+  }
+}`,
+	})
+
+	ports, err := composePublishedPorts(context.Background(), repoPath, "app", template.Services["app"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range ports {
+		got = append(got, fmt.Sprintf("%s %s %s %d", p.Owner, p.Project, p.Protocol, p.Port))
+	}
+	want := []string{
+		"app/dns app udp 5353",
+		"app/web app tcp 8080",
+		"app/web app tcp 8443",
+		"app/web app tcp 8444",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ports = %q, want %q", got, want)
+	}
+}
+
+func TestComposePublishedPortsRejectsBadRange(t *testing.T) {
+	fakeDocker(t)
+	targetDir := t.TempDir()
+	template := testTemplate(t, `
+services:
+  app:
+    clone: { repo: https://example.com/app.git }
+    compose: {}
+`)
+	repoPath := writeClone(t, targetDir, "app", map[string]string{
+		"config.json": `{"name": "app", "services": {"web": {"ports": [{"published": "9000-8000"}]}}}`,
+	})
+
+	_, err := composePublishedPorts(context.Background(), repoPath, "app", template.Services["app"])
+	if err == nil || !strings.Contains(err.Error(), `unexpected published port range "9000-8000"`) {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// isolatedEnvKeys are passed through from your shell even when a service is isolated, since
+// commands cannot find tools, git credentials or a terminal without them.
+var isolatedEnvKeys = []string{"HOME", "LANG", "LC_ALL", "LOGNAME", "PATH", "SHELL", "SSH_AUTH_SOCK", "TERM", "TMPDIR", "TZ", "USER"}
+
+// envPolicy controls how a service's environment is combined with your shell's. By default a
+// non-empty shell value wins over the template's; keys listed in Force always take the
+// template's value, keys in Unset are removed, and Isolate starts from an empty environment
+// apart from isolatedEnvKeys and the keys in Inherit.
+type envPolicy struct {
+	Force   []string `yaml:"force,omitempty"`
+	Unset   []string `yaml:"unset,omitempty"`
+	Isolate *bool    `yaml:"isolate,omitempty"`
+	Inherit []string `yaml:"inherit,omitempty"`
+}
+
+// merge returns the defaults in p combined with a service's own policy: lists are combined and
+// the service's isolate setting wins when it has one.
+func (p *envPolicy) merge(svc *envPolicy) *envPolicy {
+	if p == nil && svc == nil {
+		return nil
+	}
+	merged := &envPolicy{}
+	for _, layer := range []*envPolicy{p, svc} {
+		if layer == nil {
+			continue
+		}
+		merged.Force = appendNew(merged.Force, layer.Force...)
+		merged.Unset = appendNew(merged.Unset, layer.Unset...)
+		merged.Inherit = appendNew(merged.Inherit, layer.Inherit...)
+		if layer.Isolate != nil {
+			isolate := *layer.Isolate
+			merged.Isolate = &isolate
+		}
+	}
+	return merged
+}
+
+func appendNew(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+func (p *envPolicy) isolated() bool {
+	return p != nil && p.Isolate != nil && *p.Isolate
+}
+
+func (p *envPolicy) forced(key string) bool {
+	return p != nil && slices.Contains(p.Force, key)
+}
+
+func (p *envPolicy) unset(key string) bool {
+	return p != nil && slices.Contains(p.Unset, key)
+}
+
+// shellValue returns your shell's value for key if the service can see it.
+func (p *envPolicy) shellValue(key string) (string, bool) {
+	if p.isolated() && !slices.Contains(isolatedEnvKeys, key) && !slices.Contains(p.Inherit, key) {
+		return "", false
+	}
+	return os.LookupEnv(key)
+}
+
+// serviceEnv is a service's template environment and the policy for applying it.
+type serviceEnv struct {
+	Values map[string]string
+	Policy *envPolicy
+	// fromDefaults marks the keys inherited from defaults.environment.
+	fromDefaults map[string]bool
+}
+
+func (svc repoService) env() serviceEnv {
+	return serviceEnv{Values: svc.Environment, Policy: svc.EnvPolicy, fromDefaults: svc.defaultEnvKeys}
+}
+
+// Where the value of an environment variable comes from.
+const (
+	envFromTemplate = "template"
+	envFromDefaults = "template defaults"
+	envFromShell    = "shell"
+	envFromForced   = "forced by template"
+	envFromUnset    = "unset"
+	envFromInherit  = "inherited from shell"
+)
+
+// envEntry is one variable of the environment a service's commands run with.
+type envEntry struct {
+	Key    string
+	Value  string
+	Source string
+	// Note explains a value that was passed over, such as a template value your shell overrides.
+	Note string
+}
+
+// explain lists the variables the template decides: every template key with its final value,
+// every unset key and, for an isolated service, the shell variables still passed through.
+// Other shell variables are passed through unchanged unless the service is isolated.
+func (e serviceEnv) explain() []envEntry {
+	keys := make([]string, 0, len(e.Values))
+	for key := range e.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var entries []envEntry
+	for _, key := range keys {
+		if e.Policy.unset(key) {
+			continue
+		}
+		entry := envEntry{Key: key, Value: e.Values[key], Source: envFromTemplate}
+		if e.fromDefaults[key] {
+			entry.Source = envFromDefaults
+		}
+		shell, ok := e.Policy.shellValue(key)
+		switch {
+		case e.Policy.forced(key):
+			entry.Source = envFromForced
+			if ok && shell != "" && shell != entry.Value {
+				entry.Note = fmt.Sprintf("your shell has %q", shell)
+			}
+		case ok && shell != "" && shell != entry.Value:
+			entry.Note = fmt.Sprintf("%s has %q", entry.Source, entry.Value)
+			entry.Value = shell
+			entry.Source = envFromShell
+		}
+		entries = append(entries, entry)
+	}
+
+	if e.Policy == nil {
+		return entries
+	}
+	for _, key := range e.Policy.Unset {
+		entry := envEntry{Key: key, Source: envFromUnset}
+		if shell, ok := os.LookupEnv(key); ok {
+			entry.Note = fmt.Sprintf("your shell has %q", shell)
+		}
+		entries = append(entries, entry)
+	}
+	if e.Policy.isolated() {
+		inherited := appendNew(slices.Clone(isolatedEnvKeys), e.Policy.Inherit...)
+		sort.Strings(inherited)
+		for _, key := range inherited {
+			if _, ok := e.Values[key]; ok || e.Policy.unset(key) {
+				continue
+			}
+			if shell, ok := os.LookupEnv(key); ok {
+				entries = append(entries, envEntry{Key: key, Value: shell, Source: envFromInherit})
+			}
+		}
+	}
+	return entries
+}
+
+// mergedEnv returns the environment a service's commands run with: your shell's environment (or
+// only the variables an isolated service inherits) with the template's values applied as
+// explain describes them.
+func mergedEnv(env serviceEnv) []string {
+	values := map[string]string{}
+	for _, kv := range os.Environ() {
+		key, val, _ := strings.Cut(kv, "=")
+		if _, visible := env.Policy.shellValue(key); visible {
+			values[key] = val
+		}
+	}
+	for _, entry := range env.explain() {
+		if entry.Source == envFromUnset {
+			delete(values, entry.Key)
+			continue
+		}
+		values[entry.Key] = entry.Value
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]string, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, fmt.Sprintf("%s=%s", k, values[k]))
+	}
+	return result
+}
+
+// printEnvExplanation writes one line per variable the template decides, with its source.
+func printEnvExplanation(w io.Writer, indent string, env serviceEnv) {
+	if env.Policy.isolated() {
+		fmt.Fprintf(w, "%s(isolated: only the variables below reach commands)\n", indent)
+	}
+	entries := env.explain()
+	if len(entries) == 0 {
+		fmt.Fprintf(w, "%s(none)\n", indent)
+		return
+	}
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s%s=%s", indent, entry.Key, entry.Value)
+		if entry.Source == envFromUnset {
+			line = indent + entry.Key
+		}
+		detail := entry.Source
+		if entry.Note != "" {
+			detail += ", " + entry.Note
+		}
+		fmt.Fprintf(w, "%s (%s)\n", line, detail)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultEnvFile        = ".env"
+	defaultEnvExampleFile = ".env.example"
+)
+
+// bareEnvValue matches values that can be written to a .env file without quotes.
+var bareEnvValue = regexp.MustCompile(`^[A-Za-z0-9_./:@,+-]*$`)
+
+func (e *serviceEnvFile) path() string {
+	if strings.TrimSpace(e.Path) == "" {
+		return defaultEnvFile
+	}
+	return e.Path
+}
+
+func (e *serviceEnvFile) example() string {
+	if strings.TrimSpace(e.Example) == "" {
+		return defaultEnvExampleFile
+	}
+	return e.Example
+}
+
+// dotenvLine is one line of a .env file. Key is empty for blank lines and comments.
+type dotenvLine struct {
+	Raw   string
+	Key   string
+	Value string
+}
+
+// parseDotenv reads KEY=value lines, accepting an "export " prefix, single or double quoted
+// values and trailing comments after unquoted values.
+func parseDotenv(data []byte) []dotenvLine {
+	var lines []dotenvLine
+	for _, raw := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		line := dotenvLine{Raw: strings.TrimSuffix(raw, "\r")}
+		text := strings.TrimSpace(line.Raw)
+		if text == "" || strings.HasPrefix(text, "#") {
+			lines = append(lines, line)
+			continue
+		}
+
+		text = strings.TrimPrefix(text, "export ")
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+		line.Key = strings.TrimSpace(key)
+		line.Value = unquoteEnvValue(strings.TrimSpace(value))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func unquoteEnvValue(value string) string {
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		quote := value[0]
+		for i := 1; i < len(value); i++ {
+			switch {
+			case value[i] == '\\' && quote == '"':
+				i++
+			case value[i] == quote:
+				inner := value[1:i]
+				if quote == '\'' {
+					return inner
+				}
+				return strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n").Replace(inner)
+			}
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// formatEnvLine writes KEY=value, double-quoting values that need it.
+func formatEnvLine(key, value string) string {
+	if bareEnvValue.MatchString(value) {
+		return key + "=" + value
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return key + `="` + escaped + `"`
+}
+
+// What generating a .env file does to a key.
+const (
+	envKeyAdded   = "added"
+	envKeyUpdated = "updated"
+	// envKeyKept marks a value changed by hand, which is left alone.
+	envKeyKept = "kept"
+)
+
+// envFileChange describes what generating a .env file does to one key.
+type envFileChange struct {
+	Key  string
+	Kind string
+	// Old is the value in the existing file; empty for added keys.
+	Old string
+	New string
+}
+
+// envFileResult is a rendered .env file and how it differs from the file on disk.
+type envFileResult struct {
+	Path     string
+	Contents []byte
+	Changes  []envFileChange
+	// Values are the template values the file should hold, as recorded for the next run.
+	Values map[string]string
+	exists bool
+}
+
+// renderEnvFile builds the .env file for svc in repoPath. The wanted values are the example
+// file's entries overlaid with the service's environment (which already includes template
+// defaults and local override layers). previous holds the values DevTools last wrote: a key
+// whose current value differs from both previous and the template was changed by hand and
+// is kept. Keys the template does not know about are never touched.
+func renderEnvFile(repoPath string, svc repoService, previous map[string]string) (envFileResult, error) {
+	cfg := svc.EnvFile
+	result := envFileResult{Path: filepath.Join(repoPath, cfg.path())}
+
+	var exampleLines []dotenvLine
+	example, err := os.ReadFile(filepath.Join(repoPath, cfg.example()))
+	switch {
+	case err == nil:
+		exampleLines = parseDotenv(example)
+	case !errors.Is(err, fs.ErrNotExist) || cfg.Example != "":
+		return result, fmt.Errorf("read %s: %w", cfg.example(), err)
+	}
+
+	wanted := make(map[string]string)
+	var order []string
+	want := func(key, value string) {
+		if _, ok := wanted[key]; !ok {
+			order = append(order, key)
+		}
+		wanted[key] = value
+	}
+	for _, line := range exampleLines {
+		if line.Key != "" {
+			want(line.Key, line.Value)
+		}
+	}
+	keys := make([]string, 0, len(svc.Environment))
+	for key := range svc.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		want(key, svc.Environment[key])
+	}
+	result.Values = make(map[string]string, len(wanted))
+	for key, value := range wanted {
+		result.Values[key] = recordedEnvValue(value)
+	}
+
+	current, err := os.ReadFile(result.Path)
+	switch {
+	case err == nil:
+		result.exists = true
+	case errors.Is(err, fs.ErrNotExist):
+		// A new file starts from the example so its comments and layout are kept.
+		current = example
+	default:
+		return result, fmt.Errorf("read %s: %w", cfg.path(), err)
+	}
+
+	lines := parseDotenv(current)
+	if len(bytes.TrimSpace(current)) == 0 {
+		lines = nil
+	}
+	index := make(map[string]int)
+	for i, line := range lines {
+		if line.Key != "" {
+			index[line.Key] = i
+		}
+	}
+
+	var added []string
+	for _, key := range order {
+		value := wanted[key]
+		i, ok := index[key]
+		switch {
+		case !ok:
+			added = append(added, formatEnvLine(key, value))
+			result.Changes = append(result.Changes, envFileChange{Key: key, Kind: envKeyAdded, New: value})
+		case !result.exists:
+			// Fresh from the example: take the template's value without treating it as a change by hand.
+			if lines[i].Value != value {
+				lines[i].Raw = formatEnvLine(key, value)
+			}
+			result.Changes = append(result.Changes, envFileChange{Key: key, Kind: envKeyAdded, New: value})
+		case lines[i].Value == value:
+		case previous != nil && matchesRecorded(previous[key], lines[i].Value):
+			result.Changes = append(result.Changes, envFileChange{Key: key, Kind: envKeyUpdated, Old: lines[i].Value, New: value})
+			lines[i].Raw = formatEnvLine(key, value)
+		default:
+			result.Changes = append(result.Changes, envFileChange{Key: key, Kind: envKeyKept, Old: lines[i].Value, New: value})
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line.Raw)
+		b.WriteByte('\n')
+	}
+	if len(added) > 0 && result.exists {
+		b.WriteString("# Added by devtools\n")
+	}
+	for _, line := range added {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	result.Contents = []byte(b.String())
+	return result, nil
+}
+
+// recordedEnvValue is value as the run journal keeps it: secrets are stored as a digest.
+func recordedEnvValue(value string) string {
+	if isSecretValue(value) {
+		return secretDigest(value)
+	}
+	return value
+}
+
+// matchesRecorded reports whether value is the one the journal recorded, in plain text or, for a
+// secret, as its digest.
+func matchesRecorded(recorded, value string) bool {
+	return recorded == value || recorded == secretDigest(value)
+}
+
+// changed reports whether writing the result would modify the file on disk.
+func (r envFileResult) changed() bool {
+	if !r.exists {
+		return true
+	}
+	for _, c := range r.Changes {
+		if c.Kind != envKeyKept {
+			return true
+		}
+	}
+	return false
+}
+
+// printEnvFileDiff shows the changes to a .env file, one key per line: + added, - and + for a
+// new value, and a note for values kept because they were changed by hand.
+func printEnvFileDiff(w io.Writer, name string, r envFileResult) {
+	if len(r.Changes) == 0 {
+		fmt.Fprintf(w, "%s is up to date\n", name)
+		return
+	}
+
+	if r.exists {
+		fmt.Fprintf(w, "changes to %s:\n", name)
+	} else {
+		fmt.Fprintf(w, "creating %s:\n", name)
+	}
+	for _, c := range r.Changes {
+		// A secret's previous value is not necessarily known to the redactor, so hide both.
+		show := func(value string) string {
+			if isSecretValue(c.New) {
+				return c.Key + "=" + redactedValue
+			}
+			return formatEnvLine(c.Key, value)
+		}
+		switch c.Kind {
+		case envKeyKept:
+			fmt.Fprintf(w, "  = %s (changed locally, template has %s)\n", show(c.Old), show(c.New))
+		case envKeyUpdated:
+			fmt.Fprintf(w, "  - %s\n", show(c.Old))
+			fmt.Fprintf(w, "  + %s\n", show(c.New))
+		default:
+			fmt.Fprintf(w, "  + %s\n", show(c.New))
+		}
+	}
+}
+
+// writeServiceEnvFile renders name's .env file, shows how it differs from the file on disk and,
+// unless dryRun is set, writes it and records the template values in the run journal. state
+// may be nil, as for worktrees, in which case nothing is recorded and a value that differs
+// from the template is always treated as changed by hand.
+func writeServiceEnvFile(out io.Writer, state *workspaceState, repoPath, name string, svc repoService, dryRun bool) error {
+	var previous map[string]string
+	if state != nil {
+		previous = state.envFile(name)
+	}
+
+	result, err := renderEnvFile(repoPath, svc, previous)
+	if err != nil {
+		return fmt.Errorf("service %q: %w", name, err)
+	}
+	printEnvFileDiff(out, svc.EnvFile.path(), result)
+	if dryRun {
+		return nil
+	}
+
+	if result.changed() {
+		mode := fs.FileMode(0o644)
+		if info, err := os.Stat(result.Path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(result.Path, result.Contents, mode); err != nil {
+			return fmt.Errorf("service %q: write %s: %w", name, svc.EnvFile.path(), err)
+		}
+	}
+	if state != nil {
+		return state.recordEnvFile(name, result.Values)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRenderEnvFile(t *testing.T) {
+	const missing = "\x00missing"
+
+	for _, tc := range []struct {
+		name        string
+		example     string
+		current     string
+		env         map[string]string
+		previous    map[string]string
+		want        string
+		wantChanges []string
+	}{
+		{
+			name:        "new file without an example",
+			example:     missing,
+			current:     missing,
+			env:         map[string]string{"B": "two words", "A": "1"},
+			want:        "A=1\nB=\"two words\"\n",
+			wantChanges: []string{"A added", "B added"},
+		},
+		{
+			name:        "new file keeps the example's layout",
+			example:     "# database\nA=x\nC=keep\n",
+			current:     missing,
+			env:         map[string]string{"A": "1"},
+			want:        "# database\nA=1\nC=keep\n",
+			wantChanges: []string{"A added", "C added"},
+		},
+		{
+			name:        "value written by devtools is updated",
+			example:     missing,
+			current:     "A=old\nX=mine\n",
+			env:         map[string]string{"A": "new"},
+			previous:    map[string]string{"A": "old"},
+			want:        "A=new\nX=mine\n",
+			wantChanges: []string{"A updated"},
+		},
+		{
+			name:        "value changed by hand is kept",
+			example:     missing,
+			current:     "A=hand\n",
+			env:         map[string]string{"A": "new"},
+			previous:    map[string]string{"A": "old"},
+			want:        "A=hand\n",
+			wantChanges: []string{"A kept"},
+		},
+		{
+			name:        "without a journal a different value is kept",
+			example:     missing,
+			current:     "A=old\n",
+			env:         map[string]string{"A": "new"},
+			want:        "A=old\n",
+			wantChanges: []string{"A kept"},
+		},
+		{
+			name:        "missing keys are appended",
+			example:     missing,
+			current:     "export A=1 # set up\n",
+			env:         map[string]string{"A": "1", "B": "2"},
+			want:        "export A=1 # set up\n# Added by devtools\nB=2\n",
+			wantChanges: []string{"B added"},
+		},
+		{
+			name:    "quoted values compare unquoted",
+			example: missing,
+			current: "A=\"two words\"\nB='x'\n",
+			env:     map[string]string{"A": "two words", "B": "x"},
+			want:    "A=\"two words\"\nB='x'\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repoPath := t.TempDir()
+			for name, contents := range map[string]string{defaultEnvExampleFile: tc.example, defaultEnvFile: tc.current} {
+				if contents == missing {
+					continue
+				}
+				if err := os.WriteFile(filepath.Join(repoPath, name), []byte(contents), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			svc := repoService{Environment: tc.env, EnvFile: &serviceEnvFile{}}
+			result, err := renderEnvFile(repoPath, svc, tc.previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result.Contents) != tc.want {
+				t.Errorf("contents:\n%s\nwant:\n%s", result.Contents, tc.want)
+			}
+			var changes []string
+			for _, c := range result.Changes {
+				changes = append(changes, c.Key+" "+c.Kind)
+			}
+			if !slices.Equal(changes, tc.wantChanges) {
+				t.Errorf("changes = %q, want %q", changes, tc.wantChanges)
+			}
+		})
+	}
+}
+
+func TestRenderEnvFileMissingExample(t *testing.T) {
+	svc := repoService{EnvFile: &serviceEnvFile{Example: "config/.env.sample"}}
+	if _, err := renderEnvFile(t.TempDir(), svc, nil); err == nil {
+		t.Error("a missing example file named in the template was accepted")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// repoStatus summarises the state of a local clone.
+type repoStatus struct {
+	Branch     string
+	Detached   bool
+	Upstream   string
+	Ahead      int
+	Behind     int
+	Changed    int
+	Untracked  int
+	LastCommit time.Time
+	// Sparse lists the cone directories of a sparse checkout; it is nil for a full checkout.
+	Sparse []string
+	// Filter is the partial clone filter the clone was made with, such as blob:none.
+	Filter string
+}
+
+// dirty reports whether the clone has uncommitted changes to tracked files.
+func (s repoStatus) dirty() bool {
+	return s.Changed > 0
+}
+
+// gitOutput runs git in dir and returns its trimmed stdout, including stderr in any error.
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// inspectRepo reads branch, upstream divergence, working tree changes and last commit time.
+func inspectRepo(ctx context.Context, dir string) (repoStatus, error) {
+	var status repoStatus
+
+	out, err := gitOutput(ctx, dir, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		return status, err
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "# branch.head "):
+			head := strings.TrimPrefix(line, "# branch.head ")
+			if head == "(detached)" {
+				status.Detached = true
+			} else {
+				status.Branch = head
+			}
+		case strings.HasPrefix(line, "# branch.upstream "):
+			status.Upstream = strings.TrimPrefix(line, "# branch.upstream ")
+		case strings.HasPrefix(line, "# branch.ab "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# branch.ab "))
+			if len(fields) == 2 {
+				status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[0], "+"))
+				status.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[1], "-"))
+			}
+		case strings.HasPrefix(line, "? "):
+			status.Untracked++
+		case strings.HasPrefix(line, "1 "), strings.HasPrefix(line, "2 "), strings.HasPrefix(line, "u "):
+			status.Changed++
+		}
+	}
+
+	if ts, err := gitOutput(ctx, dir, "log", "-1", "--format=%ct"); err == nil && ts != "" {
+		if secs, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			status.LastCommit = time.Unix(secs, 0)
+		}
+	}
+
+	if sparse, err := sparseCheckoutPaths(ctx, dir); err == nil {
+		status.Sparse = sparse
+	}
+	status.Filter, _ = gitOutput(ctx, dir, "config", "--get", "remote.origin.partialclonefilter")
+
+	return status, nil
+}
+
+// sparseCheckoutPaths returns the directories a sparse checkout is limited to, or nil when the
+// clone has a full checkout.
+func sparseCheckoutPaths(ctx context.Context, dir string) ([]string, error) {
+	enabled, _ := gitOutput(ctx, dir, "config", "--get", "--bool", "core.sparseCheckout")
+	if enabled != "true" {
+		return nil, nil
+	}
+
+	out, err := gitOutput(ctx, dir, "sparse-checkout", "list")
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// syncSparseCheckout brings a clone's sparse checkout in line with the cone directories in want,
+// the service's clone.sparse. Services that declare none are not managed: a sparse checkout made
+// by hand is kept and only reported. Clones with uncommitted changes are left alone. It reports
+// whether the checkout changed and a note explaining what happened, which is empty when nothing
+// needed doing.
+func syncSparseCheckout(ctx context.Context, dir string, want []string, status repoStatus) (bool, string, error) {
+	want = slices.Sorted(slices.Values(want))
+	switch {
+	case len(want) == 0 && status.Sparse == nil:
+		return false, "", nil
+	case len(want) == 0:
+		return false, "sparse checkout kept as it is (the template declares no sparse paths)", nil
+	case slices.Equal(want, status.Sparse):
+		return false, "", nil
+	case status.dirty():
+		return false, "sparse checkout differs from the template but was left alone because of uncommitted changes", nil
+	}
+
+	args := append([]string{"sparse-checkout", "set", "--cone", "--"}, want...)
+	if _, err := gitOutput(ctx, dir, args...); err != nil {
+		return false, "", err
+	}
+	return true, "sparse checkout now limited to " + strings.Join(want, ", "), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// gitRepo creates a repository with one commit holding a file in each of dirs.
+func gitRepo(t *testing.T, dirs ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, d, "file.txt"), []byte(d), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+func TestSyncSparseCheckout(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name        string
+		sparse      []string
+		want        []string
+		wantChanged bool
+		wantPaths   []string
+	}{
+		{"full checkout, none declared", nil, nil, false, nil},
+		{"sparse by hand, none declared", []string{"api"}, nil, false, []string{"api"}},
+		{"full checkout, paths declared", nil, []string{"web", "api"}, true, []string{"api", "web"}},
+		{"paths widened", []string{"api"}, []string{"api", "web"}, true, []string{"api", "web"}},
+		{"paths unchanged", []string{"api"}, []string{"api"}, false, []string{"api"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := gitRepo(t, "api", "web", "docs")
+			if tc.sparse != nil {
+				if _, err := gitOutput(ctx, dir, append([]string{"sparse-checkout", "set", "--cone", "--"}, tc.sparse...)...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			status, err := inspectRepo(ctx, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changed, _, err := syncSparseCheckout(ctx, dir, tc.want, status)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tc.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tc.wantChanged)
+			}
+			paths, err := sparseCheckoutPaths(ctx, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(paths, tc.wantPaths) {
+				t.Errorf("sparse paths = %q, want %q", paths, tc.wantPaths)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Health check types supported by serviceHealth.Type.
+const (
+	healthExec = "exec"
+	healthHTTP = "http"
+	healthTCP  = "tcp"
+)
+
+// maxHealthBody caps how much of an HTTP response is read when matching the body.
+const maxHealthBody = 1 << 20
+
+// defaultProbeTimeout bounds each http and tcp attempt when no timeout is configured.
+const defaultProbeTimeout = 10 * time.Second
+
+// runHealthCheck polls the configured probe until it passes or the retries are exhausted.
+func runHealthCheck(ctx context.Context, out io.Writer, repoPath, serviceName string, cfg *serviceHealth, env serviceEnv) error {
+	return pollHealthCheck(ctx, out, repoPath, serviceName, cfg, env, nil)
+}
+
+// pollHealthCheck is runHealthCheck calling attempted, when non-nil, after every attempt with how
+// long the probe took and why it failed.
+func pollHealthCheck(ctx context.Context, out io.Writer, repoPath, serviceName string, cfg *serviceHealth, env serviceEnv, attempted func(attempt int, took time.Duration, err error)) error {
+	kind, err := cfg.kind()
+	if err != nil {
+		return fmt.Errorf("service %q: %w", serviceName, err)
+	}
+	if kind == "" {
+		return nil
+	}
+
+	var probe func(ctx context.Context) error
+	switch kind {
+	case healthExec:
+		environ := mergedEnv(env)
+		probe = func(ctx context.Context) error {
+			return execProbe(ctx, out, repoPath, strings.TrimSpace(cfg.Command), environ)
+		}
+	case healthHTTP:
+		var bodyPattern *regexp.Regexp
+		if cfg.BodyRegex != "" {
+			bodyPattern, err = regexp.Compile(cfg.BodyRegex)
+			if err != nil {
+				return fmt.Errorf("service %q: invalid healthCheck.bodyRegex: %w", serviceName, err)
+			}
+		}
+		probe = func(ctx context.Context) error {
+			return httpProbe(ctx, cfg, bodyPattern)
+		}
+	case healthTCP:
+		probe = func(ctx context.Context) error {
+			return tcpProbe(ctx, strings.TrimSpace(cfg.Address))
+		}
+	}
+
+	retries := cfg.retries()
+	interval := cfg.interval()
+	timeout := cfg.timeout()
+
+	for attempt := 1; attempt <= retries; attempt++ {
+		fmt.Fprintf(out, "health check attempt %d/%d: %s\n", attempt, retries, cfg.describe())
+
+		runCtx := ctx
+		cancel := func() {}
+		if timeout > 0 {
+			runCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
+		started := time.Now()
+		err := probe(runCtx)
+		cancel()
+		if attempted != nil {
+			attempted(attempt, time.Since(started), err)
+		}
+
+		if err == nil {
+			fmt.Fprintln(out, "health check passed")
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if kind != healthExec {
+			fmt.Fprintf(out, "health check not ready: %v\n", err)
+		}
+
+		if attempt < retries {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+	}
+
+	return fmt.Errorf("service %q: health check failed after %d attempt(s)", serviceName, retries)
+}
+
+func execProbe(ctx context.Context, out io.Writer, repoPath, command string, env []string) error {
+	cmd := exec.CommandContext(ctx, "bash", "-lc", command)
+	cmd.Dir = repoPath
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Env = env
+	return cmd.Run()
+}
+
+func httpProbe(ctx context.Context, cfg *serviceHealth, bodyPattern *regexp.Regexp) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(cfg.URL), nil)
+	if err != nil {
+		return err
+	}
+	for key, val := range cfg.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if cfg.Status != 0 && resp.StatusCode != cfg.Status {
+		return fmt.Errorf("got status %d, want %d", resp.StatusCode, cfg.Status)
+	}
+	if cfg.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Errorf("got status %d, want 2xx", resp.StatusCode)
+	}
+
+	if cfg.Body == "" && bodyPattern == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBody))
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+	if cfg.Body != "" && !strings.Contains(string(body), cfg.Body) {
+		return fmt.Errorf("response body does not contain %q", cfg.Body)
+	}
+	if bodyPattern != nil && !bodyPattern.Match(body) {
+		return fmt.Errorf("response body does not match /%s/", bodyPattern)
+	}
+	return nil
+}
+
+func tcpProbe(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// kind returns the probe type, inferring it from the populated fields when type is omitted.
+// An empty result means there is nothing to check.
+func (cfg *serviceHealth) kind() (string, error) {
+	kind := strings.ToLower(strings.TrimSpace(cfg.Type))
+	if kind == "" {
+		switch {
+		case strings.TrimSpace(cfg.URL) != "":
+			kind = healthHTTP
+		case strings.TrimSpace(cfg.Address) != "":
+			kind = healthTCP
+		case strings.TrimSpace(cfg.Command) != "":
+			kind = healthExec
+		default:
+			return "", nil
+		}
+	}
+
+	switch kind {
+	case healthExec:
+		if strings.TrimSpace(cfg.Command) == "" {
+			return "", errors.New("exec health check requires a command")
+		}
+	case healthHTTP:
+		if strings.TrimSpace(cfg.URL) == "" {
+			return "", errors.New("http health check requires a url")
+		}
+	case healthTCP:
+		if strings.TrimSpace(cfg.Address) == "" {
+			return "", errors.New("tcp health check requires an address (host:port)")
+		}
+	default:
+		return "", fmt.Errorf("unknown health check type %q (want exec, http or tcp)", cfg.Type)
+	}
+	return kind, nil
+}
+
+// describe renders the probe for progress output and plans.
+func (cfg *serviceHealth) describe() string {
+	kind, err := cfg.kind()
+	if err != nil {
+		return err.Error()
+	}
+
+	switch kind {
+	case healthHTTP:
+		parts := []string{"GET " + strings.TrimSpace(cfg.URL)}
+		if cfg.Status != 0 {
+			parts = append(parts, fmt.Sprintf("expect %d", cfg.Status))
+		} else {
+			parts = append(parts, "expect 2xx")
+		}
+		if cfg.Body != "" {
+			parts = append(parts, fmt.Sprintf("body contains %q", cfg.Body))
+		}
+		if cfg.BodyRegex != "" {
+			parts = append(parts, fmt.Sprintf("body matches /%s/", cfg.BodyRegex))
+		}
+		return strings.Join(parts, ", ")
+	case healthTCP:
+		return "connect tcp " + strings.TrimSpace(cfg.Address)
+	default:
+		return strings.TrimSpace(cfg.Command)
+	}
+}
+
+// retries returns the configured attempt count, defaulting to 5.
+func (cfg *serviceHealth) retries() int {
+	if cfg.Retries <= 0 {
+		return 5
+	}
+	return cfg.Retries
+}
+
+// interval returns the pause between attempts, defaulting to 5s.
+func (cfg *serviceHealth) interval() time.Duration {
+	if cfg.Interval != "" {
+		if parsed, err := time.ParseDuration(cfg.Interval); err == nil {
+			return parsed
+		}
+	}
+	return time.Second * 5
+}
+
+// timeout returns the per-attempt timeout. http and tcp probes default to defaultProbeTimeout so
+// a hung endpoint cannot stall a run; exec probes are unbounded unless a timeout is configured.
+func (cfg *serviceHealth) timeout() time.Duration {
+	if cfg.Timeout != "" {
+		if parsed, err := time.ParseDuration(cfg.Timeout); err == nil {
+			return parsed
+		}
+	}
+	if kind, _ := cfg.kind(); kind == healthHTTP || kind == healthTCP {
+		return defaultProbeTimeout
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// syncOutput serialises complete lines from concurrently running services onto one writer,
+// redacting secret values, and copies them to the run log when there is one.
+type syncOutput struct {
+	mu  sync.Mutex
+	w   io.Writer
+	log *runLog
+}
+
+func newSyncOutput(w io.Writer) *syncOutput {
+	return &syncOutput{w: w}
+}
+
+func (o *syncOutput) writeLine(line []byte) {
+	o.writeServiceLine("", line, nil)
+}
+
+// writeServiceLine writes tagged, a line of service's output with its prefix, and logs line
+// without the prefix to the service's own log.
+func (o *syncOutput) writeServiceLine(service string, tagged, line []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, _ = io.WriteString(o.w, redactSecrets(string(tagged)))
+	o.log.write(service, tagged, line)
+}
+
+// Write writes p, which must hold whole lines, so reports can be printed to the console.
+func (o *syncOutput) Write(p []byte) (int, error) {
+	o.writeLine(p)
+	return len(p), nil
+}
+
+func (o *syncOutput) printf(format string, args ...any) {
+	o.writeLine([]byte(fmt.Sprintf(format, args...)))
+}
+
+// serviceWriter buffers partial lines and emits whole lines tagged with the service name,
+// so output from parallel clones never interleaves mid-line.
+type serviceWriter struct {
+	mu     sync.Mutex
+	out    *syncOutput
+	name   string
+	prefix []byte
+	buf    []byte
+}
+
+func newServiceWriter(out *syncOutput, serviceName string) *serviceWriter {
+	return &serviceWriter{out: out, name: serviceName, prefix: []byte("[" + serviceName + "] ")}
+}
+
+func (w *serviceWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		w.emit(w.buf[:idx+1])
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes any trailing partial line.
+func (w *serviceWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return
+	}
+	w.emit(append(w.buf, '\n'))
+	w.buf = nil
+}
+
+func (w *serviceWriter) emit(line []byte) {
+	tagged := make([]byte, 0, len(w.prefix)+len(line))
+	tagged = append(tagged, w.prefix...)
+	tagged = append(tagged, line...)
+	w.out.writeServiceLine(w.name, tagged, line)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Kinds of revision a service can be pinned to.
+const (
+	pinBranch = "branch"
+	pinTag    = "tag"
+	pinCommit = "commit"
+)
+
+var commitPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// revisionPin is the branch, tag or commit a service's clone should be on.
+type revisionPin struct {
+	Kind string
+	Ref  string
+}
+
+func (p revisionPin) String() string {
+	if p.Kind == "" {
+		return "default branch"
+	}
+	return p.Kind + " " + p.Ref
+}
+
+// pin returns the revision the service is pinned to. A zero pin means the remote's default branch.
+func (s repoService) pin() (revisionPin, error) {
+	var pins []revisionPin
+	for _, p := range []revisionPin{{pinBranch, s.Branch}, {pinTag, s.Tag}, {pinCommit, s.Commit}} {
+		p.Ref = strings.TrimSpace(p.Ref)
+		if p.Ref != "" {
+			pins = append(pins, p)
+		}
+	}
+
+	switch {
+	case len(pins) == 0:
+		return revisionPin{}, nil
+	case len(pins) > 1:
+		return revisionPin{}, fmt.Errorf("only one of branch, tag or commit may be set (found %s and %s)", pins[0].Kind, pins[1].Kind)
+	}
+
+	p := pins[0]
+	switch {
+	case strings.ContainsAny(p.Ref, " \t"):
+		return revisionPin{}, fmt.Errorf("%s %q must not contain whitespace", p.Kind, p.Ref)
+	case p.Kind == pinCommit && !commitPattern.MatchString(p.Ref):
+		return revisionPin{}, fmt.Errorf("commit %q must be a hexadecimal SHA of 7 to 40 characters", p.Ref)
+	}
+	return p, nil
+}
+
+// cloneArgs returns the extra `git clone` arguments that check out the pin directly.
+// Commits cannot be cloned by name, so they are checked out afterwards by checkoutPin.
+func (p revisionPin) cloneArgs() []string {
+	switch p.Kind {
+	case pinBranch, pinTag:
+		return []string{"--branch", p.Ref}
+	}
+	return nil
+}
+
+// checkoutPin moves a fresh clone onto a pinned commit, fetching it first if the clone
+// does not already contain it.
+func checkoutPin(ctx context.Context, out io.Writer, repoPath string, p revisionPin) error {
+	if p.Kind != pinCommit {
+		return nil
+	}
+
+	target, err := resolvePin(ctx, repoPath, p)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "checking out commit %s\n", p.Ref)
+	_, err = gitOutput(ctx, repoPath, "checkout", "--detach", target)
+	return err
+}
+
+// resolvePin returns the full commit SHA a tag or commit pin refers to, fetching a commit from
+// origin when it is not yet present locally.
+func resolvePin(ctx context.Context, repoPath string, p revisionPin) (string, error) {
+	rev := p.Ref
+	if p.Kind == pinTag {
+		rev = "refs/tags/" + p.Ref
+	}
+
+	sha, err := gitOutput(ctx, repoPath, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	switch {
+	case err == nil:
+		return sha, nil
+	case p.Kind != pinCommit:
+		return "", fmt.Errorf("%s not found in %s", p, repoPath)
+	}
+
+	if _, err := gitOutput(ctx, repoPath, "fetch", "origin", p.Ref); err != nil {
+		return "", fmt.Errorf("%s not found locally and could not be fetched: %w", p, err)
+	}
+	sha, err = gitOutput(ctx, repoPath, "rev-parse", "--verify", "--quiet", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%s not found in %s", p, repoPath)
+	}
+	return sha, nil
+}
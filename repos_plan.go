@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// printClonePlan describes what cloneServices would do for the given services without
+// cloning, running commands or writing anything to disk. Secret values are redacted.
+func printClonePlan(w io.Writer, targetDir string, template *repoTemplate, names []string, opts cloneOptions) error {
+	w = redactingWriter{w}
+	state, err := loadWorkspaceState(targetDir)
+	if err != nil {
+		return err
+	}
+
+	onFailure := "stop at the first failure"
+	if opts.KeepGoing {
+		onFailure = "continue with independent services"
+	}
+
+	fmt.Fprintf(w, "\n=== Clone Plan (no changes will be made) ===\n")
+	fmt.Fprintf(w, "Workspace   : %s\n", targetDir)
+	fmt.Fprintf(w, "Parallelism : %d job(s), %s\n", opts.jobs(), onFailure)
+
+	pending, err := pendingProvisioning(targetDir, state, template, names)
+	if err != nil {
+		return err
+	}
+	conflicts, err := findPortConflicts(template, pending, portInUse)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		fmt.Fprintln(w)
+		printPortConflicts(w, conflicts)
+		if !opts.IgnorePortConflicts {
+			fmt.Fprintln(w, "The run would stop here; pass --ignore-port-conflicts to provision anyway.")
+		}
+	}
+
+	for i, name := range names {
+		svc := template.Services[name]
+
+		clone, err := parseCloneCommand(name, svc.Clone)
+		if err != nil {
+			return err
+		}
+		clonePath := filepath.Join(targetDir, clone.Dir)
+
+		exists, err := pathExists(clonePath)
+		if err != nil {
+			return fmt.Errorf("service %q: unable to inspect %s: %w", name, clonePath, err)
+		}
+
+		fmt.Fprintf(w, "\n%d. %s\n", i+1, name)
+		fmt.Fprintf(w, "   depends      : %s\n", formatDependencies(svc.Depends))
+		pin, err := svc.pin()
+		if err != nil {
+			return fmt.Errorf("service %q: %w", name, err)
+		}
+
+		fmt.Fprintf(w, "   repository   : %s\n", clone.RepoURL)
+		fmt.Fprintf(w, "   revision     : %s\n", pin)
+		if len(clone.Sparse) > 0 {
+			fmt.Fprintf(w, "   sparse       : %s\n", strings.Join(clone.Sparse, ", "))
+		}
+		fmt.Fprintf(w, "   path         : %s\n", clonePath)
+		ports, err := svc.declaredPorts()
+		if err != nil {
+			return fmt.Errorf("service %q: %w", name, err)
+		}
+		if len(ports) > 0 {
+			described := make([]string, 0, len(ports))
+			for _, p := range ports {
+				described = append(described, fmt.Sprintf("%d (%s)", p.Port, p.Source))
+			}
+			fmt.Fprintf(w, "   ports        : %s\n", strings.Join(described, ", "))
+		}
+
+		steps := postCloneSteps(svc.PostCloneCmds)
+		start := 0
+		progress, tracked := state.service(name)
+		switch {
+		case !exists:
+			fmt.Fprintf(w, "   action       : git %s\n", strings.Join(clone.argsFor(pin), " "))
+			if pin.Kind == pinCommit {
+				fmt.Fprintf(w, "                  git checkout --detach %s\n", pin.Ref)
+			}
+		case !tracked || progress.provisioned(svc):
+			fmt.Fprintln(w, "   action       : skip (directory already exists)")
+			continue
+		default:
+			start = progress.resumeIndex(steps)
+			fmt.Fprintf(w, "   action       : resume (%d of %d post-clone command(s) completed previously)\n", start, len(steps))
+		}
+
+		if svc.EnvFile != nil {
+			fmt.Fprintf(w, "   env file     : %s (from %s and the environment below)\n", svc.EnvFile.path(), svc.EnvFile.example())
+		}
+		printPlanCommands(w, steps, start)
+		printPlanEnvironment(w, svc.env())
+		printPlanHealthCheck(w, svc.HealthCheck)
+	}
+
+	return nil
+}
+
+func printPlanCommands(w io.Writer, steps []string, start int) {
+	fmt.Fprintln(w, "   post-clone   :")
+	if len(steps) == 0 {
+		fmt.Fprintln(w, "     (none)")
+	}
+	for i, step := range steps {
+		if i < start {
+			fmt.Fprintf(w, "     %d) %s (done)\n", i+1, step)
+			continue
+		}
+		fmt.Fprintf(w, "     %d) %s\n", i+1, step)
+	}
+}
+
+// printPlanEnvironment shows the final value of each template variable as mergedEnv would
+// resolve it, and where it comes from.
+func printPlanEnvironment(w io.Writer, env serviceEnv) {
+	fmt.Fprintln(w, "   environment  :")
+	printEnvExplanation(w, "     ", env)
+}
+
+func printPlanHealthCheck(w io.Writer, cfg *serviceHealth) {
+	if cfg == nil {
+		fmt.Fprintln(w, "   health check : (none)")
+		return
+	}
+
+	kind, err := cfg.kind()
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "   health check : invalid (%v)\n", err)
+		return
+	case kind == "":
+		fmt.Fprintln(w, "   health check : (none)")
+		return
+	}
+
+	timeout := "none"
+	if t := cfg.timeout(); t > 0 {
+		timeout = t.String()
+	}
+	fmt.Fprintf(w, "   health check : %s\n", cfg.describe())
+	fmt.Fprintf(w, "                  up to %d attempt(s), every %s, timeout %s\n", cfg.retries(), cfg.interval(), timeout)
+}
+
+// pathExists reports whether path exists, treating only "not exist" as a negative answer.
+func pathExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, os.ErrNotExist):
+		return false, nil
+	default:
+		return false, err
+	}
+}
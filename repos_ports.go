@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// portRefPrefix marks a ${port:NAME} reference to an assigned port.
+	portRefPrefix = "port:"
+	// defaultPortRange is used for ${port:NAME} references when the template sets no portRange.
+	defaultPortRange = "20000-29999"
+	// portOffsetEnv shifts the start of the port range, so developers sharing a machine, or one
+	// developer with two workspaces, are handed different ports.
+	portOffsetEnv = "DEVTOOLS_PORT_OFFSET"
+)
+
+// servicePort is a host port a service declares, either in its ports list or through an
+// environment value whose key ends in _PORT.
+type servicePort struct {
+	Port int
+	// Source is "ports" or the environment key that declared the port.
+	Source string
+}
+
+// portConflict is a declared port that more than one service claims or that is already bound.
+type portConflict struct {
+	Port int
+	// Owners lists each claim as "<service> (<source>)".
+	Owners []string
+	InUse  bool
+}
+
+// declaredPorts returns the ports svc listens on, in ascending order. A port named both in the
+// ports list and by an environment key is reported once, under the first source found.
+func (svc repoService) declaredPorts() ([]servicePort, error) {
+	seen := make(map[int]bool)
+	var ports []servicePort
+	add := func(port int, source string) {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, servicePort{Port: port, Source: source})
+		}
+	}
+
+	for _, value := range svc.Ports {
+		port, err := parsePort(value)
+		if err != nil {
+			return nil, fmt.Errorf("ports: %w", err)
+		}
+		add(port, "ports")
+	}
+
+	keys := make([]string, 0, len(svc.Environment))
+	for key := range svc.Environment {
+		if isPortKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// Only whole numbers count; values such as "auto" are left to the service.
+		if port, err := parsePort(svc.Environment[key]); err == nil {
+			add(port, key)
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports, nil
+}
+
+// isPortKey reports whether an environment key names a port, e.g. API_PORT.
+func isPortKey(key string) bool {
+	key = strings.ToUpper(key)
+	return key == "PORT" || strings.HasSuffix(key, "_PORT")
+}
+
+// parsePort parses a TCP port number between 1 and 65535.
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%q is not a port number between 1 and 65535", value)
+	}
+	return port, nil
+}
+
+// parsePortRange parses a "low-high" range of ports.
+func parsePortRange(value string) (int, int, error) {
+	lowText, highText, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("port range %q must be written as low-high, e.g. %s", value, defaultPortRange)
+	}
+	low, err := parsePort(lowText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("port range %q: %w", value, err)
+	}
+	high, err := parsePort(highText)
+	if err != nil {
+		return 0, 0, fmt.Errorf("port range %q: %w", value, err)
+	}
+	if high < low {
+		return 0, 0, fmt.Errorf("port range %q ends before it starts", value)
+	}
+	return low, high, nil
+}
+
+// portRange returns the ports ${port:NAME} references are assigned from, with the start moved
+// up by DEVTOOLS_PORT_OFFSET when it is set.
+func (t *repoTemplate) portRange() (int, int, error) {
+	value := t.PortRange
+	if value == "" {
+		value = defaultPortRange
+	}
+	low, high, err := parsePortRange(value)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if text := strings.TrimSpace(os.Getenv(portOffsetEnv)); text != "" {
+		offset, err := strconv.Atoi(text)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%s=%q must be a whole number of zero or more", portOffsetEnv, text)
+		}
+		low += offset
+		if low > high {
+			return 0, 0, fmt.Errorf("%s=%d leaves no ports in the range %s", portOffsetEnv, offset, value)
+		}
+	}
+	return low, high, nil
+}
+
+// portInUse reports whether something on this machine is already listening on the TCP port.
+func portInUse(port int) bool {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return errors.Is(err, syscall.EADDRINUSE)
+	}
+	ln.Close()
+	return false
+}
+
+// findPortConflicts checks the ports of the services about to be provisioned against the ports
+// every other service in the template declares, and against ports already bound on the machine
+// when inUse is non-nil.
+func findPortConflicts(template *repoTemplate, pending []string, inUse func(port int) bool) ([]portConflict, error) {
+	owners := make(map[int][]string)
+	for _, name := range sortedServiceNames(template) {
+		ports, err := template.Services[name].declaredPorts()
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		for _, p := range ports {
+			owners[p.Port] = append(owners[p.Port], fmt.Sprintf("%s (%s)", name, p.Source))
+		}
+	}
+
+	checked := make(map[int]bool)
+	var conflicts []portConflict
+	for _, name := range pending {
+		ports, err := template.Services[name].declaredPorts()
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		for _, p := range ports {
+			if checked[p.Port] {
+				continue
+			}
+			checked[p.Port] = true
+
+			conflict := portConflict{Port: p.Port, Owners: owners[p.Port]}
+			if inUse != nil {
+				conflict.InUse = inUse(p.Port)
+			}
+			if len(conflict.Owners) > 1 || conflict.InUse {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Port < conflicts[j].Port })
+	return conflicts, nil
+}
+
+// pendingProvisioning returns the services among names whose post-clone commands a clone run
+// would execute: those not cloned yet and those whose last run stopped part way.
+func pendingProvisioning(targetDir string, state *workspaceState, template *repoTemplate, names []string) ([]string, error) {
+	var pending []string
+	for _, name := range names {
+		svc := template.Services[name]
+		clone, err := parseCloneCommand(name, svc.Clone)
+		if err != nil {
+			return nil, err
+		}
+		clonePath := filepath.Join(targetDir, clone.Dir)
+		exists, err := pathExists(clonePath)
+		if err != nil {
+			return nil, fmt.Errorf("service %q: unable to inspect %s: %w", name, clonePath, err)
+		}
+
+		progress, tracked := state.service(name)
+		if !exists || (tracked && !progress.provisioned(svc)) {
+			pending = append(pending, name)
+		}
+	}
+	return pending, nil
+}
+
+// checkPortConflicts reports port conflicts among the services a clone run is about to provision
+// and fails the run before anything is cloned or started.
+func checkPortConflicts(w io.Writer, targetDir string, state *workspaceState, template *repoTemplate, names []string) error {
+	pending, err := pendingProvisioning(targetDir, state, template, names)
+	if err != nil {
+		return err
+	}
+	conflicts, err := findPortConflicts(template, pending, portInUse)
+	if err != nil || len(conflicts) == 0 {
+		return err
+	}
+
+	printPortConflicts(w, conflicts)
+	return fmt.Errorf("%d port conflict(s) found before provisioning; free the ports or change the template (--ignore-port-conflicts provisions anyway)", len(conflicts))
+}
+
+func printPortConflicts(w io.Writer, conflicts []portConflict) {
+	fmt.Fprintln(w, "Port conflicts:")
+	for _, c := range conflicts {
+		line := fmt.Sprintf("  %d: %s", c.Port, strings.Join(c.Owners, ", "))
+		if c.InUse {
+			line += " - already in use on this machine"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	workspaceReportsDir = "reports"
+	cloneReportJSON     = "clone-report.json"
+	cloneReportJUnit    = "clone-report.xml"
+)
+
+// Outcomes recorded for services and their steps in a run report.
+const (
+	reportPassed  = "passed"
+	reportFailed  = "failed"
+	reportSkipped = "skipped"
+	reportNotRun  = "not run"
+	// reportDoneEarlier marks post-clone commands an earlier, interrupted run already completed.
+	reportDoneEarlier = "done earlier"
+	// Clone outcomes besides failed, skipped and not run.
+	reportCloned   = "cloned"
+	reportExisting = "existing"
+)
+
+// runReport describes a clone run for CI: what happened to each service, every post-clone command
+// with its exit code and duration, and each health check attempt. Commands and errors have secret
+// values redacted.
+type runReport struct {
+	Command    string           `json:"command"`
+	Workspace  string           `json:"workspace"`
+	StartedAt  time.Time        `json:"startedAt"`
+	DurationMs int64            `json:"durationMs"`
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	Logs       string           `json:"logs,omitempty"`
+	Services   []*serviceReport `json:"services"`
+
+	byName map[string]*serviceReport
+}
+
+type serviceReport struct {
+	Name        string          `json:"name"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	DurationMs  int64           `json:"durationMs"`
+	Clone       cloneReport     `json:"clone"`
+	PostClone   []commandReport `json:"postClone"`
+	HealthCheck *healthReport   `json:"healthCheck,omitempty"`
+
+	started time.Time
+}
+
+type cloneReport struct {
+	Outcome    string `json:"outcome"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+type commandReport struct {
+	Command    string `json:"command"`
+	Status     string `json:"status"`
+	ExitCode   *int   `json:"exitCode,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Probe    string                `json:"probe"`
+	Status   string                `json:"status"`
+	Attempts []healthAttemptReport `json:"attempts"`
+}
+
+type healthAttemptReport struct {
+	Attempt    int    `json:"attempt"`
+	Passed     bool   `json:"passed"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// newCloneReport starts the report for cloning names, listing every step as not run until it is.
+// Lists start empty rather than nil so the JSON always holds arrays.
+func newCloneReport(targetDir string, template *repoTemplate, names []string) *runReport {
+	report := &runReport{
+		Command:   "clone",
+		Workspace: targetDir,
+		StartedAt: time.Now(),
+		Services:  make([]*serviceReport, 0, len(names)),
+		byName:    make(map[string]*serviceReport, len(names)),
+	}
+	for _, name := range names {
+		svc := template.Services[name]
+		entry := &serviceReport{Name: name, Status: reportNotRun, Clone: cloneReport{Outcome: reportNotRun}, PostClone: []commandReport{}}
+		for _, step := range postCloneSteps(svc.PostCloneCmds) {
+			entry.PostClone = append(entry.PostClone, commandReport{Command: redactSecrets(step), Status: reportNotRun})
+		}
+		if svc.HealthCheck != nil {
+			if kind, err := svc.HealthCheck.kind(); err == nil && kind != "" {
+				entry.HealthCheck = &healthReport{Probe: redactSecrets(svc.HealthCheck.describe()), Status: reportNotRun, Attempts: []healthAttemptReport{}}
+			}
+		}
+		report.Services = append(report.Services, entry)
+		report.byName[name] = entry
+	}
+	return report
+}
+
+// service returns the entry for name, or nil when the report has none. All recording methods
+// accept a nil entry so callers outside a clone run need no checks.
+func (r *runReport) service(name string) *serviceReport {
+	if r == nil {
+		return nil
+	}
+	return r.byName[name]
+}
+
+// skip records that name was not provisioned because of reason.
+func (r *runReport) skip(name, reason string) {
+	entry := r.service(name)
+	if entry == nil {
+		return
+	}
+	entry.Status = reportSkipped
+	entry.Error = reason
+	entry.Clone.Outcome = reportSkipped
+}
+
+// finish records how the run ended.
+func (r *runReport) finish(runErr error) {
+	r.DurationMs = time.Since(r.StartedAt).Milliseconds()
+	r.Status = reportPassed
+	if runErr != nil {
+		r.Status = reportFailed
+		r.Error = redactSecrets(runErr.Error())
+	}
+}
+
+func (s *serviceReport) start() {
+	if s != nil {
+		s.started = time.Now()
+	}
+}
+
+// cloned records the outcome of the clone step.
+func (s *serviceReport) cloned(existing bool, took time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.Clone = cloneReport{Outcome: reportCloned, DurationMs: took.Milliseconds()}
+	switch {
+	case err != nil:
+		s.Clone.Outcome = reportFailed
+		s.Clone.Error = redactSecrets(err.Error())
+	case existing:
+		s.Clone.Outcome = reportExisting
+	}
+}
+
+// doneEarlier marks the first n post-clone commands as completed by an earlier run.
+func (s *serviceReport) doneEarlier(n int) {
+	if s == nil {
+		return
+	}
+	for i := 0; i < n && i < len(s.PostClone); i++ {
+		s.PostClone[i].Status = reportDoneEarlier
+	}
+}
+
+// commandRan records the result of post-clone command i.
+func (s *serviceReport) commandRan(i int, took time.Duration, err error) {
+	if s == nil || i >= len(s.PostClone) {
+		return
+	}
+	entry := &s.PostClone[i]
+	entry.DurationMs = took.Milliseconds()
+	entry.Status = reportPassed
+	code := 0
+	if err != nil {
+		entry.Status = reportFailed
+		entry.Error = redactSecrets(err.Error())
+		code = exitCode(err)
+	}
+	entry.ExitCode = &code
+}
+
+// healthAttempted records one health check attempt.
+func (s *serviceReport) healthAttempted(attempt int, took time.Duration, err error) {
+	if s == nil || s.HealthCheck == nil {
+		return
+	}
+	entry := healthAttemptReport{Attempt: attempt, Passed: err == nil, DurationMs: took.Milliseconds()}
+	if err != nil {
+		entry.Error = redactSecrets(err.Error())
+	}
+	s.HealthCheck.Attempts = append(s.HealthCheck.Attempts, entry)
+}
+
+// healthChecked records the final status of the health check.
+func (s *serviceReport) healthChecked(err error) {
+	if s == nil || s.HealthCheck == nil {
+		return
+	}
+	s.HealthCheck.Status = reportPassed
+	if err != nil {
+		s.HealthCheck.Status = reportFailed
+	}
+}
+
+// finish records how provisioning the service ended.
+func (s *serviceReport) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.DurationMs = time.Since(s.started).Milliseconds()
+	s.Status = reportPassed
+	if err != nil {
+		s.Status = reportFailed
+		s.Error = redactSecrets(err.Error())
+	}
+}
+
+// exitCode returns the exit status of a failed command, or -1 when it did not exit normally.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// reportsDir returns where clone reports are written when no directory is given.
+func reportsDir(targetDir string) string {
+	return filepath.Join(targetDir, workspaceMetaDir, workspaceReportsDir)
+}
+
+// write saves the report to dir as JSON and as JUnit XML and returns the paths written.
+func (r *runReport) write(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create report directory: %w", err)
+	}
+
+	contents, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	jsonPath := filepath.Join(dir, cloneReportJSON)
+	if err := os.WriteFile(jsonPath, append(contents, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("write report: %w", err)
+	}
+
+	contents, err = xml.MarshalIndent(r.junit(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	junitPath := filepath.Join(dir, cloneReportJUnit)
+	contents = append([]byte(xml.Header), contents...)
+	if err := os.WriteFile(junitPath, append(contents, '\n'), 0o644); err != nil {
+		return nil, fmt.Errorf("write report: %w", err)
+	}
+	return []string{jsonPath, junitPath}, nil
+}
+
+// JUnit XML as read by common CI servers: one test suite per service and one test case per step.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+func junitTime(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// junit converts the report to JUnit XML. Steps that did not run are reported as skipped, and a
+// service that failed outside its steps (writing its .env file, say) gets a failed "provision" case.
+func (r *runReport) junit() junitTestSuites {
+	suites := junitTestSuites{Name: "devtools " + r.Command, Time: junitTime(r.DurationMs)}
+	for _, svc := range r.Services {
+		suite := junitTestSuite{Name: svc.Name, Time: junitTime(svc.DurationMs)}
+		if !svc.started.IsZero() {
+			suite.Timestamp = svc.started.UTC().Format("2006-01-02T15:04:05")
+		}
+		stepFailed := false
+		add := func(name string, ms int64, status, message, detail string) {
+			tc := junitTestCase{Name: name, ClassName: svc.Name, Time: junitTime(ms)}
+			switch status {
+			case reportFailed:
+				tc.Failure = &junitFailure{Message: message, Text: detail}
+				suite.Failures++
+				stepFailed = true
+			case reportSkipped, reportNotRun, reportDoneEarlier:
+				tc.Skipped = &junitSkipped{Message: message}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, tc)
+			suite.Tests++
+		}
+
+		cloneStatus, cloneMessage := svc.Clone.Outcome, svc.Clone.Error
+		switch cloneStatus {
+		case reportSkipped, reportNotRun:
+			cloneMessage = svc.Error
+			if cloneMessage == "" {
+				cloneMessage = "not run"
+			}
+		case reportExisting:
+			cloneStatus = reportPassed
+		}
+		add("clone", svc.Clone.DurationMs, cloneStatus, cloneMessage, svc.Clone.Error)
+
+		for _, cmd := range svc.PostClone {
+			message := cmd.Status
+			if cmd.ExitCode != nil && cmd.Status == reportFailed {
+				message = fmt.Sprintf("exit code %d", *cmd.ExitCode)
+			}
+			add("post-clone: "+cmd.Command, cmd.DurationMs, cmd.Status, message, cmd.Error)
+		}
+
+		if hc := svc.HealthCheck; hc != nil {
+			var total int64
+			var detail strings.Builder
+			for _, attempt := range hc.Attempts {
+				total += attempt.DurationMs
+				result := "passed"
+				if !attempt.Passed {
+					result = attempt.Error
+				}
+				fmt.Fprintf(&detail, "attempt %d: %s\n", attempt.Attempt, result)
+			}
+			message := hc.Status
+			if hc.Status == reportFailed {
+				message = fmt.Sprintf("failed after %d attempt(s)", len(hc.Attempts))
+			}
+			add("health check: "+hc.Probe, total, hc.Status, message, detail.String())
+		}
+
+		if svc.Status == reportFailed && !stepFailed {
+			add("provision", svc.DurationMs, reportFailed, svc.Error, svc.Error)
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+	return suites
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCloneReportListsAreArrays(t *testing.T) {
+	template := testTemplate(t, `
+services:
+  api:
+    clone: { repo: https://example.com/api.git }
+    healthCheck: { command: "true" }
+`)
+	report := newCloneReport(t.TempDir(), template, []string{"api"})
+	report.skip("api", "dependency failed")
+
+	contents, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Services []struct {
+			PostClone   any `json:"postClone"`
+			HealthCheck struct {
+				Attempts any `json:"attempts"`
+			} `json:"healthCheck"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(contents, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	svc := decoded.Services[0]
+	if want := []any{}; !reflect.DeepEqual(svc.PostClone, want) || !reflect.DeepEqual(svc.HealthCheck.Attempts, want) {
+		t.Errorf("postClone = %#v, attempts = %#v, want empty arrays", svc.PostClone, svc.HealthCheck.Attempts)
+	}
+}
@@ -10,15 +10,18 @@ import (
 	"strings"
 )
 
-const (
-	defaultTemplatePath = "template.yml"
-	defaultRepoDir      = "dev-app"
-)
-
 // ReposTask drives the interactive menu for cloning repositories.
 type ReposTask struct {
-	TemplatePath string
-	TargetDir    string
+	workspaceConfig
+	Jobs                int
+	KeepGoing           bool
+	IgnorePortConflicts bool
+	ReportDir           string
+}
+
+// ID returns the command-line identifier for this task.
+func (s *ReposTask) ID() string {
+	return "repos"
 }
 
 // Name returns the menu label for this task.
@@ -33,33 +36,96 @@ func (s *ReposTask) Description() string {
 
 // Run presents a submenu that lets developers clone every repo or a single service with its dependencies.
 func (s *ReposTask) Run(ctx context.Context) error {
-	templatePath := s.templatePath()
-	template, err := loadRepoTemplate(templatePath, templatePath == defaultTemplatePath)
-	if err != nil {
-		return err
-	}
-
-	targetDir := s.targetDir()
-
-	order, err := template.cloneOrder()
+	template, order, err := s.loadTemplate()
 	if err != nil {
 		return err
 	}
 
 	scanner := bufio.NewScanner(os.Stdin)
+	planMode := false
 
 	for {
-		fmt.Println("\n=== Clone Repos ===")
-		fmt.Println("1. Clone all services")
+		items := []repoMenuItem{
+			{
+				label: "Clone all services",
+				action: func() error {
+					return s.cloneOrPlan(ctx, template, order, planMode)
+				},
+			},
+		}
+
+		for _, profile := range template.profileNames() {
+			items = append(items, repoMenuItem{
+				label: fmt.Sprintf("Profile %s (%s)", profile, formatDependencies(template.Profiles[profile])),
+				action: func() error {
+					cloneList, err := template.cloneListForProfile(profile)
+					if err != nil {
+						return err
+					}
 
-		for i, name := range order {
+					fmt.Printf("\nCloning sequence: %s\n", strings.Join(cloneList, ", "))
+					return s.cloneOrPlan(ctx, template, cloneList, planMode)
+				},
+			})
+		}
+
+		for _, name := range order {
 			svc := template.Services[name]
 			deps := formatDependencies(svc.Depends)
-			fmt.Printf("%d. %s (depends: %s)\n", i+2, name, deps)
+			items = append(items, repoMenuItem{
+				label: fmt.Sprintf("%s (depends: %s)", name, deps),
+				action: func() error {
+					cloneList, err := template.cloneListFor(name)
+					if err != nil {
+						return err
+					}
+
+					fmt.Printf("\nCloning sequence: %s\n", strings.Join(cloneList, ", "))
+					return s.cloneOrPlan(ctx, template, cloneList, planMode)
+				},
+			})
 		}
 
-		backOption := len(order) + 2
-		exitOption := len(order) + 3
+		items = append(items, repoMenuItem{
+			label: "Update existing clones (fetch and fast-forward when safe)",
+			action: func() error {
+				return updateServices(ctx, s.targetDir(), template, order, s.cloneOptions().Jobs)
+			},
+		})
+
+		items = append(items, repoMenuItem{
+			label: "Regenerate .env files (keeps values you changed by hand)",
+			action: func() error {
+				return s.writeEnvFiles(ctx, template, order, planMode)
+			},
+		})
+
+		items = append(items, repoMenuItem{
+			label: "Re-provision a service (rerun its post-clone commands and health check)",
+			action: func() error {
+				name, ok := promptService(scanner, order, "Service to re-provision")
+				if !ok {
+					return nil
+				}
+				return s.reprovision(ctx, template, name, planMode)
+			},
+		})
+
+		items = append(items, repoMenuItem{
+			label: fmt.Sprintf("Plan mode: %s (show what would happen without cloning)", onOff(planMode)),
+			action: func() error {
+				planMode = !planMode
+				return nil
+			},
+		})
+
+		fmt.Println("\n=== Clone Repos ===")
+		for i, item := range items {
+			fmt.Printf("%d. %s\n", i+1, item.label)
+		}
+
+		backOption := len(items) + 1
+		exitOption := len(items) + 2
 
 		fmt.Printf("\n")
 		fmt.Printf("%d. Back to main menu\n", backOption)
@@ -81,20 +147,8 @@ func (s *ReposTask) Run(ctx context.Context) error {
 		}
 
 		switch {
-		case choice == 1:
-			if err := cloneServices(ctx, targetDir, template, order); err != nil {
-				return err
-			}
-		case choice >= 2 && choice < backOption:
-			idx := choice - 2
-			name := order[idx]
-			cloneList, err := template.cloneListFor(name)
-			if err != nil {
-				return err
-			}
-
-			fmt.Printf("\nCloning sequence: %s\n", strings.Join(cloneList, ", "))
-			if err := cloneServices(ctx, targetDir, template, cloneList); err != nil {
+		case choice >= 1 && choice < backOption:
+			if err := items[choice-1].action(); err != nil {
 				return err
 			}
 		case choice == backOption:
@@ -108,20 +162,321 @@ func (s *ReposTask) Run(ctx context.Context) error {
 	}
 }
 
-// templatePath returns the configured template path or the default.
-func (s *ReposTask) templatePath() string {
-	if s.TemplatePath != "" {
-		return s.TemplatePath
+// repoMenuItem is a numbered entry in the Clone Repos submenu.
+type repoMenuItem struct {
+	label  string
+	action func() error
+}
+
+// Subcommands exposes listing and cloning to the CLI.
+func (s *ReposTask) Subcommands() []Subcommand {
+	return []Subcommand{
+		{
+			Name:    "list",
+			Summary: "List services in clone order and the template's profiles",
+			Run:     s.runList,
+		},
+		{
+			Name:    "clone",
+			Summary: "Clone all services, a profile, or one service with its dependencies",
+			Run:     s.runClone,
+		},
+		{
+			Name:    "update",
+			Summary: "Fetch existing clones and fast-forward them when safe",
+			Run:     s.runUpdate,
+		},
+		{
+			Name:    "reprovision",
+			Summary: "Reset a service's progress and rerun its post-clone commands",
+			Run:     s.runReprovision,
+		},
+		{
+			Name:    "env",
+			Summary: "Regenerate the .env files of cloned services from the template",
+			Run:     s.runEnv,
+		},
+	}
+}
+
+func (s *ReposTask) runList(ctx context.Context, args []string) error {
+	fs := newCommandFlags("repos list", "List services in clone order with their dependencies, followed by the template's profiles.")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, order, err := s.loadTemplate()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range order {
+		fmt.Printf("%s (depends: %s)\n", name, formatDependencies(template.Services[name].Depends))
+	}
+
+	if profiles := template.profileNames(); len(profiles) > 0 {
+		fmt.Println("\nProfiles:")
+		for _, profile := range profiles {
+			fmt.Printf("%s: %s\n", profile, formatDependencies(template.Profiles[profile]))
+		}
+	}
+	return nil
+}
+
+func (s *ReposTask) runClone(ctx context.Context, args []string) error {
+	fs := newCommandFlags("repos clone", "Clone all services, the services of a profile, or a single service together with its dependencies.")
+	service := fs.String("service", "", "clone only this service and its dependencies")
+	profile := fs.String("profile", "", "clone the services in this template profile and their dependencies")
+	fs.IntVar(&s.Jobs, "jobs", s.cloneOptions().Jobs, "maximum number of services provisioned in parallel")
+	fs.BoolVar(&s.KeepGoing, "keep-going", s.KeepGoing, "continue with independent services after a failure")
+	fs.BoolVar(&s.IgnorePortConflicts, "ignore-port-conflicts", s.IgnorePortConflicts, "provision even when declared ports clash or are already in use")
+	fs.StringVar(&s.ReportDir, "report-dir", s.ReportDir, "write the JSON and JUnit reports here (default: <workspace>/.devtools/reports)")
+	plan := fs.Bool("plan", false, "print the execution plan without cloning or running anything")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	if s.Jobs < 1 {
+		return usagef("repos clone: --jobs must be at least 1")
+	}
+
+	template, order, err := s.loadTemplate()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *service != "" && *profile != "":
+		return usagef("repos clone: --service and --profile cannot be combined")
+	case *service != "":
+		if _, ok := template.Services[*service]; !ok {
+			return usagef("repos clone: unknown service %q", *service)
+		}
+		order, err = template.cloneListFor(*service)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Cloning sequence: %s\n", strings.Join(order, ", "))
+	case *profile != "":
+		if _, ok := template.Profiles[*profile]; !ok {
+			return usagef("repos clone: unknown profile %q", *profile)
+		}
+		order, err = template.cloneListForProfile(*profile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Cloning sequence: %s\n", strings.Join(order, ", "))
+	}
+
+	return s.cloneOrPlan(ctx, template, order, *plan)
+}
+
+func (s *ReposTask) runUpdate(ctx context.Context, args []string) error {
+	fs := newCommandFlags("repos update", "Fetch each cloned service, report ahead/behind and local changes, and fast-forward the current branch when it is safe.")
+	service := fs.String("service", "", "update only this service")
+	fs.IntVar(&s.Jobs, "jobs", s.cloneOptions().Jobs, "maximum number of services updated in parallel")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, order, err := s.loadTemplate()
+	if err != nil {
+		return err
+	}
+
+	if *service != "" {
+		if _, ok := template.Services[*service]; !ok {
+			return usagef("repos update: unknown service %q", *service)
+		}
+		order = []string{*service}
+	}
+
+	return updateServices(ctx, s.targetDir(), template, order, s.cloneOptions().Jobs)
+}
+
+func (s *ReposTask) runReprovision(ctx context.Context, args []string) error {
+	fs := newCommandFlags("repos reprovision", "Forget a service's recorded progress and run its post-clone commands and health check again.")
+	service := fs.String("service", "", "service to re-provision (required)")
+	fs.IntVar(&s.Jobs, "jobs", s.cloneOptions().Jobs, "maximum number of services provisioned in parallel")
+	fs.BoolVar(&s.IgnorePortConflicts, "ignore-port-conflicts", s.IgnorePortConflicts, "provision even when declared ports clash or are already in use, such as by the running service itself")
+	fs.StringVar(&s.ReportDir, "report-dir", s.ReportDir, "write the JSON and JUnit reports here (default: <workspace>/.devtools/reports)")
+	plan := fs.Bool("plan", false, "print the execution plan without resetting or running anything")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	if *service == "" {
+		return usagef("repos reprovision: --service is required")
+	}
+
+	template, _, err := s.loadTemplate()
+	if err != nil {
+		return err
+	}
+	if _, ok := template.Services[*service]; !ok {
+		return usagef("repos reprovision: unknown service %q", *service)
+	}
+
+	return s.reprovision(ctx, template, *service, *plan)
+}
+
+func (s *ReposTask) runEnv(ctx context.Context, args []string) error {
+	fs := newCommandFlags("repos env", "Regenerate the envFile of each cloned service from its example file and template environment, showing the changes. Values changed by hand are kept.")
+	service := fs.String("service", "", "regenerate only this service's file")
+	dryRun := fs.Bool("dry-run", false, "show the changes without writing anything")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, order, err := s.loadTemplate()
+	if err != nil {
+		return err
+	}
+	if *service != "" {
+		svc, ok := template.Services[*service]
+		if !ok {
+			return usagef("repos env: unknown service %q", *service)
+		}
+		if svc.EnvFile == nil {
+			return usagef("repos env: service %q has no envFile", *service)
+		}
+		order = []string{*service}
+	}
+
+	return s.writeEnvFiles(ctx, template, order, *dryRun)
+}
+
+// writeEnvFiles regenerates the .env files of the cloned services among names that have one.
+func (s *ReposTask) writeEnvFiles(ctx context.Context, template *repoTemplate, names []string, dryRun bool) error {
+	state, err := loadWorkspaceState(s.targetDir())
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		if err := template.ports.save(state); err != nil {
+			return err
+		}
+	}
+
+	console := newSyncOutput(os.Stdout)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		svc := template.Services[name]
+		if svc.EnvFile == nil {
+			continue
+		}
+
+		out := newServiceWriter(console, name)
+		repoPath, err := s.servicePath(template, name)
+		if err != nil {
+			return err
+		}
+		cloned, err := pathExists(repoPath)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("service %q: unable to inspect %s: %w", name, repoPath, err)
+		case !cloned:
+			fmt.Fprintln(out, "not cloned, skipping")
+		default:
+			if svc, err = template.withSecrets(name); err == nil {
+				err = writeServiceEnvFile(out, state, repoPath, name, svc, dryRun)
+			}
+		}
+		out.Flush()
+		if err != nil {
+			return err
+		}
 	}
-	return defaultTemplatePath
+	return nil
+}
+
+// reprovision resets the run journal for name and provisions it again, together with any
+// dependencies that are not yet provisioned.
+func (s *ReposTask) reprovision(ctx context.Context, template *repoTemplate, name string, plan bool) error {
+	cloneList, err := template.cloneListFor(name)
+	if err != nil {
+		return err
+	}
+
+	if plan {
+		fmt.Printf("\n%s would be reset and provisioned again from its first post-clone command.\n", name)
+		return printClonePlan(os.Stdout, s.targetDir(), template, cloneList, s.cloneOptions())
+	}
+
+	repoPath, err := s.servicePath(template, name)
+	if err != nil {
+		return err
+	}
+	cloned, err := pathExists(repoPath)
+	if err != nil {
+		return fmt.Errorf("service %q: %w", name, err)
+	}
+
+	state, err := loadWorkspaceState(s.targetDir())
+	if err != nil {
+		return err
+	}
+	if err := state.reset(name, cloned); err != nil {
+		return err
+	}
+	fmt.Printf("\nReset provisioning state for %s\n", name)
+
+	return cloneServices(ctx, s.targetDir(), template, cloneList, s.cloneOptions())
+}
+
+// cloneOrPlan clones the given services, or only prints the execution plan when plan is set.
+func (s *ReposTask) cloneOrPlan(ctx context.Context, template *repoTemplate, names []string, plan bool) error {
+	if plan {
+		return printClonePlan(os.Stdout, s.targetDir(), template, names, s.cloneOptions())
+	}
+	return cloneServices(ctx, s.targetDir(), template, names, s.cloneOptions())
+}
+
+// cloneOptions returns the scheduling options for clone runs.
+func (s *ReposTask) cloneOptions() cloneOptions {
+	jobs := s.Jobs
+	if jobs <= 0 {
+		jobs = defaultCloneJobs
+	}
+	return cloneOptions{Jobs: jobs, KeepGoing: s.KeepGoing, IgnorePortConflicts: s.IgnorePortConflicts, ReportDir: s.ReportDir}
+}
+
+// promptService asks the user to pick a service by number or name.
+func promptService(scanner *bufio.Scanner, order []string, prompt string) (string, bool) {
+	fmt.Println()
+	for i, name := range order {
+		fmt.Printf("%d. %s\n", i+1, name)
+	}
+	fmt.Printf("\n%s (number or name, blank to cancel): ", prompt)
+
+	if !scanner.Scan() {
+		return "", false
+	}
+	answer := strings.TrimSpace(scanner.Text())
+	if answer == "" {
+		return "", false
+	}
+
+	if idx, err := strconv.Atoi(answer); err == nil {
+		if idx >= 1 && idx <= len(order) {
+			return order[idx-1], true
+		}
+	}
+	for _, name := range order {
+		if name == answer {
+			return name, true
+		}
+	}
+
+	fmt.Printf("Unknown service %q.\n", answer)
+	return "", false
 }
 
-// targetDir returns the directory that repositories should be cloned into.
-func (s *ReposTask) targetDir() string {
-	if s.TargetDir != "" {
-		return s.TargetDir
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
 	}
-	return defaultRepoDir
+	return "off"
 }
 
 // formatDependencies renders a user-friendly dependency list for menu output.
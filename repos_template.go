@@ -4,7 +4,6 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 
@@ -14,44 +13,177 @@ import (
 //go:embed template.yml
 var embeddedTemplate []byte
 
-// repoTemplate represents the shape of template.yml.
+// repoTemplate represents the shape of template.yml. PortRange bounds the ports assigned to
+// ${port:NAME} references, e.g. "20000-29999", and Secrets says where ${secret:NAME} references
+// are looked up.
 type repoTemplate struct {
-	Services map[string]repoService `yaml:"services"`
+	Vars      map[string]string      `yaml:"vars,omitempty"`
+	Defaults  serviceDefaults        `yaml:"defaults,omitempty"`
+	Services  map[string]repoService `yaml:"services"`
+	Profiles  map[string][]string    `yaml:"profiles,omitempty"`
+	PortRange string                 `yaml:"portRange,omitempty"`
+	Secrets   *secretsConfig         `yaml:"secrets,omitempty"`
+
+	// ports assigns ${port:NAME} references while rendering; see portAllocator.
+	ports *portAllocator
+	// secrets resolves ${secret:NAME} references while rendering; see secretResolver.
+	secrets func(name string) (string, error)
+	// unrendered is the template as it was before render, kept for withSecrets.
+	unrendered *repoTemplate
+}
+
+// serviceDefaults holds values every service inherits unless it sets its own.
+type serviceDefaults struct {
+	Environment map[string]string `yaml:"environment,omitempty"`
+	EnvPolicy   *envPolicy        `yaml:"envPolicy,omitempty"`
 }
 
-// repoService captures the commands and relationships for a single service.
+// repoService captures the commands and relationships for a single service. At most one of
+// Branch, Tag or Commit pins the revision the clone is checked out at.
 type repoService struct {
-	Clone         string            `yaml:"clone"`
-	PostCloneCmds []string          `yaml:"postCloneCmds"`
-	Depends       []string          `yaml:"depends"`
-	Environment   map[string]string `yaml:"environment"`
-	HealthCheck   *serviceHealth    `yaml:"healthCheck"`
+	Clone         cloneSpec         `yaml:"clone"`
+	Branch        string            `yaml:"branch,omitempty"`
+	Tag           string            `yaml:"tag,omitempty"`
+	Commit        string            `yaml:"commit,omitempty"`
+	PostCloneCmds []string          `yaml:"postCloneCmds,omitempty"`
+	Teardown      []string          `yaml:"teardown,omitempty"`
+	Start         []string          `yaml:"start,omitempty"`
+	Stop          []string          `yaml:"stop,omitempty"`
+	Status        []string          `yaml:"status,omitempty"`
+	Depends       []string          `yaml:"depends,omitempty"`
+	Ports         []string          `yaml:"ports,omitempty"`
+	Environment   map[string]string `yaml:"environment,omitempty"`
+	EnvPolicy     *envPolicy        `yaml:"envPolicy,omitempty"`
+	HealthCheck   *serviceHealth    `yaml:"healthCheck,omitempty"`
+	Compose       *composeConfig    `yaml:"compose,omitempty"`
+	EnvFile       *serviceEnvFile   `yaml:"envFile,omitempty"`
+
+	// defaultEnvKeys marks the Environment keys rendering took from defaults.environment.
+	defaultEnvKeys map[string]bool
+}
+
+// cloneSpec describes how a service is cloned. It is written either as the legacy
+// `git clone <repo> [dir]` string, kept in Command, or as a mapping of named options.
+type cloneSpec struct {
+	Command      string   `yaml:"-"`
+	Repo         string   `yaml:"repo"`
+	Dir          string   `yaml:"dir,omitempty"`
+	Depth        int      `yaml:"depth,omitempty"`
+	Filter       string   `yaml:"filter,omitempty"`
+	Submodules   bool     `yaml:"submodules,omitempty"`
+	SingleBranch bool     `yaml:"singleBranch,omitempty"`
+	Sparse       []string `yaml:"sparse,omitempty"`
+}
+
+// cloneSpecFields is cloneSpec without its YAML methods, used to decode and encode the mapping form.
+type cloneSpecFields cloneSpec
+
+func (c *cloneSpec) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*c = cloneSpec{Command: node.Value}
+		return nil
+	case yaml.MappingNode:
+		var fields cloneSpecFields
+		if err := node.Decode(&fields); err != nil {
+			return err
+		}
+		*c = cloneSpec(fields)
+		c.Command = ""
+		return nil
+	default:
+		return fmt.Errorf("line %d: clone must be a 'git clone' command or a mapping with a repo", node.Line)
+	}
+}
+
+func (c cloneSpec) MarshalYAML() (any, error) {
+	if c.Command != "" {
+		return c.Command, nil
+	}
+	return cloneSpecFields(c), nil
+}
+
+// empty reports whether no clone source was given in either form.
+func (c cloneSpec) empty() bool {
+	return strings.TrimSpace(c.Command) == "" && strings.TrimSpace(c.Repo) == ""
 }
 
+// serviceEnvFile describes the .env file generated in a service's clone. It is written either as
+// the file's path or as a mapping that also names the example file to start from.
+type serviceEnvFile struct {
+	Path    string `yaml:"path,omitempty"`
+	Example string `yaml:"example,omitempty"`
+}
+
+// serviceEnvFileFields is serviceEnvFile without its YAML methods.
+type serviceEnvFileFields serviceEnvFile
+
+func (e *serviceEnvFile) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*e = serviceEnvFile{Path: node.Value}
+		return nil
+	case yaml.MappingNode:
+		var fields serviceEnvFileFields
+		if err := node.Decode(&fields); err != nil {
+			return err
+		}
+		*e = serviceEnvFile(fields)
+		return nil
+	default:
+		return fmt.Errorf("line %d: envFile must be a file path or a mapping with path and example", node.Line)
+	}
+}
+
+func (e serviceEnvFile) MarshalYAML() (any, error) {
+	if e.Example == "" {
+		return e.Path, nil
+	}
+	return serviceEnvFileFields(e), nil
+}
+
+// serviceHealth describes how to confirm a service is up. Type selects the probe: exec runs
+// Command through bash, http requests URL, tcp dials Address. When Type is omitted it is
+// inferred from whichever of url, address or command is set.
 type serviceHealth struct {
-	Command  string `yaml:"command"`
-	Interval string `yaml:"interval"`
-	Retries  int    `yaml:"retries"`
-	Timeout  string `yaml:"timeout"`
+	Type      string            `yaml:"type,omitempty"`
+	Command   string            `yaml:"command,omitempty"`
+	URL       string            `yaml:"url,omitempty"`
+	Status    int               `yaml:"status,omitempty"`
+	Body      string            `yaml:"body,omitempty"`
+	BodyRegex string            `yaml:"bodyRegex,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty"`
+	Address   string            `yaml:"address,omitempty"`
+	Interval  string            `yaml:"interval,omitempty"`
+	Retries   int               `yaml:"retries,omitempty"`
+	Timeout   string            `yaml:"timeout,omitempty"`
 }
 
-// loadRepoTemplate fetches and parses template.yml, optionally falling back to the embedded copy.
+const embeddedTemplateName = "embedded template.yml"
+
+// loadRepoTemplate fetches template.yml (optionally falling back to the embedded copy), merges
+// its includes and override layers, and renders the result.
 func loadRepoTemplate(path string, allowEmbedded bool) (*repoTemplate, error) {
-	contents, err := os.ReadFile(path)
-	switch {
-	case err == nil:
-	case allowEmbedded && errors.Is(err, os.ErrNotExist):
-		if len(embeddedTemplate) == 0 {
-			return nil, fmt.Errorf("template %q not found and no embedded default available", path)
-		}
-		fmt.Printf("template %q not found, using embedded default\n", path)
-		contents = embeddedTemplate
-	default:
-		return nil, fmt.Errorf("read template %q: %w", path, err)
+	tpl, err := decodeRepoTemplate(path, allowEmbedded)
+	if err != nil {
+		return nil, err
+	}
+	if err := tpl.render(); err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// decodeRepoTemplate is loadRepoTemplate without rendering, for callers that adjust values
+// before ${VAR} references are resolved.
+func decodeRepoTemplate(path string, allowEmbedded bool) (*repoTemplate, error) {
+	layers, err := loadTemplateLayers(path, allowEmbedded)
+	if err != nil {
+		return nil, err
 	}
 
 	var tpl repoTemplate
-	if err := yaml.Unmarshal(contents, &tpl); err != nil {
+	if err := layers.Root.Decode(&tpl); err != nil {
 		return nil, fmt.Errorf("parse template: %w", err)
 	}
 
@@ -116,12 +248,68 @@ func (t *repoTemplate) cloneOrder() ([]string, error) {
 	return order, nil
 }
 
-// cloneListFor returns the ordered set of services required for a single target service.
-func (t *repoTemplate) cloneListFor(name string) ([]string, error) {
-	if _, ok := t.Services[name]; !ok {
-		return nil, fmt.Errorf("service %q not defined", name)
+// profileNames returns the template's profile names in sorted order.
+func (t *repoTemplate) profileNames() []string {
+	names := make([]string, 0, len(t.Profiles))
+	for name := range t.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cloneListForProfile returns the ordered set of services required by every member of a profile.
+func (t *repoTemplate) cloneListForProfile(profile string) ([]string, error) {
+	members, ok := t.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not defined", profile)
+	}
+
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		if _, ok := t.Services[member]; !ok {
+			return nil, fmt.Errorf("profile %q references unknown service %q", profile, member)
+		}
+		names = append(names, member)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("profile %q has no services", profile)
+	}
+
+	return t.cloneListFor(names...)
+}
+
+// dependentsOf returns name and every service that depends on it, directly or transitively,
+// in clone order.
+func (t *repoTemplate) dependentsOf(name string) ([]string, error) {
+	order, err := t.cloneOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	affected := map[string]bool{name: true}
+	list := make([]string, 0, len(order))
+	for _, svcName := range order {
+		for _, dep := range t.Services[svcName].Depends {
+			if affected[strings.TrimSpace(dep)] {
+				affected[svcName] = true
+				break
+			}
+		}
+		if affected[svcName] {
+			list = append(list, svcName)
+		}
 	}
+	return list, nil
+}
 
+// cloneListFor returns the ordered set of services required for the target services,
+// including the transitive closure of their dependencies.
+func (t *repoTemplate) cloneListFor(names ...string) ([]string, error) {
 	required := make(map[string]struct{})
 
 	var mark func(string) error
@@ -146,12 +334,16 @@ func (t *repoTemplate) cloneListFor(name string) ([]string, error) {
 		return nil
 	}
 
-	if err := mark(name); err != nil {
-		return nil, err
+	for _, name := range names {
+		if _, ok := t.Services[name]; !ok {
+			return nil, fmt.Errorf("service %q not defined", name)
+		}
+		if err := mark(name); err != nil {
+			return nil, err
+		}
+		required[name] = struct{}{}
 	}
 
-	required[name] = struct{}{}
-
 	order, err := t.cloneOrder()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+)
+
+// Outcomes reported by updateService.
+const (
+	updateUpdated  = "updated"
+	updateCurrent  = "up to date"
+	updateSkipped  = "skipped"
+	updateRefused  = "refused"
+	updateFailed   = "failed"
+	updateNotFound = "not cloned"
+)
+
+// updateResult records what happened to one service during an update run.
+type updateResult struct {
+	Service string
+	Outcome string
+	Detail  string
+}
+
+// updateServices fetches every cloned service and fast-forwards its current branch when that is
+// safe. Clones with local changes or diverged history are left alone with an explanation.
+func updateServices(ctx context.Context, targetDir string, template *repoTemplate, names []string, jobs int) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	console := newSyncOutput(os.Stdout)
+	results := make([]updateResult, len(names))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			out := newServiceWriter(console, name)
+			results[i] = updateService(ctx, out, targetDir, name, template.Services[name])
+			out.Flush()
+		}()
+	}
+	wg.Wait()
+
+	fmt.Println()
+	printUpdateSummary(os.Stdout, results)
+
+	var failures []error
+	for _, res := range results {
+		if res.Outcome == updateFailed {
+			failures = append(failures, fmt.Errorf("service %q: %s", res.Service, res.Detail))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d service(s) failed to update: %w", len(failures), errors.Join(failures...))
+	}
+	return ctx.Err()
+}
+
+// updateService fetches a single clone and fast-forwards it if there is nothing to lose. Clones
+// pinned to a tag or commit are moved to the pinned revision instead, and clones pinned to a
+// branch are only fast-forwarded while that branch is checked out. A clean clone's sparse
+// checkout is also brought in line with the template's sparse paths. Uncommitted changes are
+// reported whatever the outcome.
+func updateService(ctx context.Context, out io.Writer, targetDir, name string, svc repoService) updateResult {
+	var sparseChanged bool
+	var sparseNote, dirtyNote string
+	result := func(outcome, format string, args ...any) updateResult {
+		detail := fmt.Sprintf(format, args...)
+		if sparseChanged && outcome == updateCurrent {
+			outcome = updateUpdated
+		}
+		if sparseNote != "" {
+			detail += "; " + sparseNote
+		}
+		if dirtyNote != "" {
+			detail += "; " + dirtyNote
+		}
+		fmt.Fprintf(out, "%s: %s\n", outcome, detail)
+		return updateResult{Service: name, Outcome: outcome, Detail: detail}
+	}
+
+	clone, err := parseCloneCommand(name, svc.Clone)
+	if err != nil {
+		return result(updateFailed, "%v", err)
+	}
+	repoPath := filepath.Join(targetDir, clone.Dir)
+	pin, err := svc.pin()
+	if err != nil {
+		return result(updateFailed, "%v", err)
+	}
+
+	exists, err := pathExists(repoPath)
+	switch {
+	case err != nil:
+		return result(updateFailed, "unable to inspect %s: %v", repoPath, err)
+	case !exists:
+		return result(updateNotFound, "%s does not exist; clone it first", repoPath)
+	}
+
+	fmt.Fprintf(out, "fetching %s\n", repoPath)
+	fetchArgs := []string{"fetch", "--prune"}
+	if pin.Kind == pinTag {
+		// The template is the source of truth for the tag, so accept it being moved upstream.
+		fetchArgs = append(fetchArgs, "--tags", "--force")
+	}
+	if _, err := gitOutput(ctx, repoPath, fetchArgs...); err != nil {
+		return result(updateFailed, "%v", err)
+	}
+
+	status, err := inspectRepo(ctx, repoPath)
+	if err != nil {
+		return result(updateFailed, "%v", err)
+	}
+	if status.dirty() {
+		dirtyNote = fmt.Sprintf("has %d uncommitted change(s)", status.Changed)
+	}
+	if sparseChanged, sparseNote, err = syncSparseCheckout(ctx, repoPath, clone.Sparse, status); err != nil {
+		return result(updateFailed, "%v", err)
+	}
+
+	switch pin.Kind {
+	case pinTag, pinCommit:
+		outcome, detail := updatePinnedRevision(ctx, repoPath, status, pin)
+		if outcome == updateRefused {
+			// The only refusal is for uncommitted changes, which the detail already names.
+			dirtyNote = ""
+		}
+		return result(outcome, "%s", detail)
+	case pinBranch:
+		if status.Detached || status.Branch != pin.Ref {
+			current := status.Branch
+			if status.Detached {
+				current = "a detached HEAD"
+			}
+			return result(updateSkipped, "template pins branch %s but %s is checked out; switch back to update", pin.Ref, current)
+		}
+	}
+
+	switch {
+	case status.Detached:
+		return result(updateSkipped, "HEAD is detached; check out a branch to update")
+	case status.Upstream == "":
+		return result(updateSkipped, "branch %s has no upstream to update from", status.Branch)
+	case status.Behind == 0 && status.Ahead > 0:
+		return result(updateCurrent, "%s is %d commit(s) ahead of %s, nothing to pull", status.Branch, status.Ahead, status.Upstream)
+	case status.Behind == 0:
+		return result(updateCurrent, "%s matches %s", status.Branch, status.Upstream)
+	case status.Ahead > 0:
+		return result(updateRefused, "%s has diverged from %s (%d ahead, %d behind); rebase or merge by hand",
+			status.Branch, status.Upstream, status.Ahead, status.Behind)
+	case status.dirty():
+		dirtyNote = ""
+		return result(updateRefused, "%s is %d commit(s) behind %s but has %d uncommitted change(s); commit or stash them first",
+			status.Branch, status.Behind, status.Upstream, status.Changed)
+	}
+
+	if _, err := gitOutput(ctx, repoPath, "merge", "--ff-only", "@{upstream}"); err != nil {
+		return result(updateFailed, "fast-forward failed: %v", err)
+	}
+	return result(updateUpdated, "fast-forwarded %s by %d commit(s) from %s", status.Branch, status.Behind, status.Upstream)
+}
+
+// updatePinnedRevision moves a clone pinned to a tag or commit onto that revision. Clones where
+// someone has checked out a branch, or that have local changes, are left alone.
+func updatePinnedRevision(ctx context.Context, repoPath string, status repoStatus, pin revisionPin) (string, string) {
+	target, err := resolvePin(ctx, repoPath, pin)
+	if err != nil {
+		return updateFailed, err.Error()
+	}
+	head, err := gitOutput(ctx, repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return updateFailed, err.Error()
+	}
+
+	switch {
+	case head == target:
+		return updateCurrent, fmt.Sprintf("at pinned %s", pin)
+	case !status.Detached:
+		return updateSkipped, fmt.Sprintf("template pins %s but branch %s is checked out; check out the pin to update", pin, status.Branch)
+	case status.dirty():
+		return updateRefused, fmt.Sprintf("pinned %s has moved but there are %d uncommitted change(s); commit or stash them first", pin, status.Changed)
+	}
+
+	if _, err := gitOutput(ctx, repoPath, "checkout", "--detach", target); err != nil {
+		return updateFailed, fmt.Sprintf("checkout failed: %v", err)
+	}
+	return updateUpdated, fmt.Sprintf("moved to pinned %s (%.7s)", pin, target)
+}
+
+func printUpdateSummary(w io.Writer, results []updateResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tRESULT\tDETAIL")
+	for _, res := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", res.Service, res.Outcome, res.Detail)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// secretRefPrefix marks a ${secret:NAME} reference.
+	secretRefPrefix = "secret:"
+	// secretEnvPrefix starts the environment variable the env provider reads, e.g.
+	// core-api/db_password is read from DEVTOOLS_SECRET_CORE_API_DB_PASSWORD.
+	secretEnvPrefix = "DEVTOOLS_SECRET_"
+	// secretsPassphraseEnv holds the passphrase of the encrypted secrets file.
+	secretsPassphraseEnv = "DEVTOOLS_SECRETS_PASSPHRASE"
+	// secretNameEnv tells a command provider which secret to print.
+	secretNameEnv = "DEVTOOLS_SECRET_NAME"
+
+	secretProviderEnv     = "env"
+	secretProviderFile    = "file"
+	secretProviderCommand = "command"
+
+	secretFileVersion    = 1
+	secretFileIterations = 600_000
+
+	// redactedValue replaces secret values in output.
+	redactedValue = "********"
+	// minRedactedLength is the shortest secret value that is redacted; shorter values would
+	// mask unrelated text.
+	minRedactedLength = 4
+)
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+
+// secretsConfig lists where ${secret:NAME} references are looked up, in order. Without it the
+// env provider is tried first and then the default encrypted file.
+type secretsConfig struct {
+	Providers []secretProvider `yaml:"providers,omitempty"`
+}
+
+// secretProvider is one place secrets come from. Path applies to the file provider and
+// Command, run through bash with DEVTOOLS_SECRET_NAME set, to the command provider.
+type secretProvider struct {
+	Type    string `yaml:"type"`
+	Path    string `yaml:"path,omitempty"`
+	Command string `yaml:"command,omitempty"`
+}
+
+// describe names where the provider looks for the named secret, for messages.
+func (p secretProvider) describe(name string) string {
+	switch p.Type {
+	case secretProviderFile:
+		return "file " + p.filePath()
+	case secretProviderCommand:
+		return "command " + p.Command
+	}
+	return "$" + secretEnvName(name)
+}
+
+func (p secretProvider) filePath() string {
+	if p.Path != "" {
+		return expandHome(p.Path)
+	}
+	return defaultSecretsFile()
+}
+
+func (p secretProvider) check() error {
+	switch p.Type {
+	case secretProviderEnv, secretProviderFile:
+		return nil
+	case secretProviderCommand:
+		if strings.TrimSpace(p.Command) == "" {
+			return errors.New("command provider needs a command")
+		}
+		return nil
+	case "":
+		return errors.New("provider type is required (env, file or command)")
+	}
+	return fmt.Errorf("unknown provider type %q (use env, file or command)", p.Type)
+}
+
+// providers returns the configured providers or the defaults.
+func (c *secretsConfig) providers() []secretProvider {
+	if c == nil || len(c.Providers) == 0 {
+		return []secretProvider{{Type: secretProviderEnv}, {Type: secretProviderFile}}
+	}
+	return c.Providers
+}
+
+// defaultSecretsFile is the encrypted file used when the file provider names no path.
+func defaultSecretsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "devtools", "secrets.enc")
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// secretEnvName returns the variable the env provider reads for name.
+func secretEnvName(name string) string {
+	var b strings.Builder
+	b.WriteString(secretEnvPrefix)
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// secretResolver looks secrets up through the configured providers, at most once per name.
+type secretResolver struct {
+	mu        sync.Mutex
+	providers []secretProvider
+	values    map[string]string
+	files     map[string]map[string]string
+}
+
+func newSecretResolver(cfg *secretsConfig) *secretResolver {
+	return &secretResolver{
+		providers: cfg.providers(),
+		values:    map[string]string{},
+		files:     map[string]map[string]string{},
+	}
+}
+
+// resolve returns the value of the named secret from the first provider that has it and
+// registers the value for redaction.
+func (r *secretResolver) resolve(name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if val, ok := r.values[name]; ok {
+		return val, nil
+	}
+
+	var tried []string
+	for _, p := range r.providers {
+		val, ok, err := r.lookup(p, name)
+		if err != nil {
+			return "", fmt.Errorf("secret %q: %w", name, err)
+		}
+		if ok {
+			r.values[name] = val
+			registerSecret(val)
+			return val, nil
+		}
+		tried = append(tried, p.describe(name))
+	}
+	return "", fmt.Errorf("secret %q not found (tried %s); set %s or run 'devtools secrets set --name %s'",
+		name, strings.Join(tried, ", "), secretEnvName(name), name)
+}
+
+func (r *secretResolver) lookup(p secretProvider, name string) (string, bool, error) {
+	switch p.Type {
+	case secretProviderEnv:
+		val, ok := os.LookupEnv(secretEnvName(name))
+		return val, ok, nil
+	case secretProviderFile:
+		path := p.filePath()
+		secrets, ok := r.files[path]
+		if !ok {
+			var err error
+			if secrets, err = readSecretsFile(path); err != nil {
+				return "", false, err
+			}
+			r.files[path] = secrets
+		}
+		val, ok := secrets[name]
+		return val, ok, nil
+	case secretProviderCommand:
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(context.Background(), "bash", "-c", p.Command)
+		cmd.Env = append(os.Environ(), secretNameEnv+"="+name)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", false, fmt.Errorf("command %q: %w: %s", p.Command, err, msg)
+			}
+			return "", false, fmt.Errorf("command %q: %w", p.Command, err)
+		}
+		// An empty answer means the command does not know the secret.
+		val := strings.TrimRight(stdout.String(), "\r\n")
+		return val, val != "", nil
+	}
+	return "", false, fmt.Errorf("unknown provider type %q", p.Type)
+}
+
+// secretReferences returns the names of the secrets the template references, each with the
+// services that use it, without looking any of them up.
+func (t *repoTemplate) secretReferences() (map[string][]string, error) {
+	refs := map[string][]string{}
+	scoped := *t
+	scoped.ports = nil
+	for _, name := range sortedServiceNames(t) {
+		scoped.secrets = func(secret string) (string, error) {
+			if !slices.Contains(refs[secret], name) {
+				refs[secret] = append(refs[secret], name)
+			}
+			return "", nil
+		}
+		if _, err := scoped.renderService(name); err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// secretFile is the on-disk form of the encrypted secrets file: a JSON object of secret names
+// to values, sealed with AES-256-GCM under a key derived from the passphrase with PBKDF2.
+type secretFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// readSecretsFile decrypts the secrets at path. A missing file holds no secrets.
+func readSecretsFile(path string) (map[string]string, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file secretFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if file.Version != secretFileVersion {
+		return nil, fmt.Errorf("%s has unsupported version %d", path, file.Version)
+	}
+
+	gcm, err := secretsCipher(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: wrong passphrase or damaged file", path)
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+// writeSecretsFile encrypts secrets to path with a fresh salt and nonce.
+func writeSecretsFile(path string, secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	file := secretFile{Version: secretFileVersion, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := secretsCipher(file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	contents, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(contents, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func secretsCipher(salt []byte) (cipher.AEAD, error) {
+	passphrase := os.Getenv(secretsPassphraseEnv)
+	if passphrase == "" {
+		return nil, fmt.Errorf("set %s to unlock the secrets file", secretsPassphraseEnv)
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, secretFileIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretValues holds every secret value resolved by this process, for redaction.
+var secretValues struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+func registerSecret(value string) {
+	if len(value) < minRedactedLength {
+		return
+	}
+	secretValues.mu.Lock()
+	defer secretValues.mu.Unlock()
+
+	for _, known := range secretValues.values {
+		if known == value {
+			return
+		}
+	}
+	secretValues.values = append(secretValues.values, value)
+	// Longest first, so a secret containing another is replaced whole.
+	sort.Slice(secretValues.values, func(i, j int) bool {
+		return len(secretValues.values[i]) > len(secretValues.values[j])
+	})
+}
+
+// redactSecrets replaces every resolved secret value in s.
+func redactSecrets(s string) string {
+	secretValues.mu.RLock()
+	defer secretValues.mu.RUnlock()
+
+	for _, value := range secretValues.values {
+		s = strings.ReplaceAll(s, value, redactedValue)
+	}
+	return s
+}
+
+// isSecretValue reports whether value is a resolved secret.
+func isSecretValue(value string) bool {
+	return len(value) >= minRedactedLength && redactSecrets(value) != value
+}
+
+// secretDigest stands in for a secret value where one has to be remembered on disk.
+func secretDigest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// redactingWriter redacts secret values from everything written through it. Writes are
+// expected to hold whole lines, as from fmt or a tabwriter flush.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactSecrets(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// SecretsTask manages the encrypted secrets file that ${secret:NAME} references are read from.
+// Values are never printed.
+type SecretsTask struct {
+	workspaceConfig
+	// File overrides the secrets file named by the template's file provider.
+	File string
+}
+
+func (t *SecretsTask) ID() string {
+	return "secrets"
+}
+
+func (t *SecretsTask) Name() string {
+	return "Secrets"
+}
+
+func (t *SecretsTask) Description() string {
+	return "Store the secrets template.yml references in an encrypted file"
+}
+
+func (t *SecretsTask) Run(ctx context.Context) error {
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Println("\n=== Secrets ===")
+		if err := t.list(os.Stdout); err != nil {
+			return err
+		}
+
+		fmt.Println("\n1. Set a secret")
+		fmt.Println("2. Remove a secret")
+		fmt.Println("3. Back to main menu")
+		fmt.Print("\nSelect option: ")
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			return errors.New("input stream closed")
+		}
+
+		var err error
+		switch strings.TrimSpace(scanner.Text()) {
+		case "1":
+			name, ok := promptLine(scanner, "Secret name (e.g. core-api/db_password)")
+			if !ok {
+				continue
+			}
+			value, ok := promptLine(scanner, "Value")
+			if !ok {
+				continue
+			}
+			err = t.set(name, value)
+		case "2":
+			name, ok := promptLine(scanner, "Secret name")
+			if !ok {
+				continue
+			}
+			err = t.remove(name)
+		case "3":
+			return nil
+		default:
+			fmt.Println("Invalid option. Please try again.")
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+// Subcommands exposes secret management to the CLI.
+func (t *SecretsTask) Subcommands() []Subcommand {
+	return []Subcommand{
+		{
+			Name:    "set",
+			Summary: "Store a secret, reading its value from stdin",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("secrets set", "Store a secret in the encrypted secrets file. The value is read from the first line of stdin, e.g. `pass show db | devtools secrets set --name core-api/db_password`.")
+				name := fs.String("name", "", "secret name as referenced by ${secret:NAME} (required)")
+				file := fs.String("file", t.File, "secrets file (default: the template's file provider)")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+				if *name == "" {
+					return usagef("secrets set: --name is required")
+				}
+				t.File = *file
+
+				value, err := readSecretValue(os.Stdin)
+				if err != nil {
+					return err
+				}
+				return t.set(*name, value)
+			},
+		},
+		{
+			Name:    "list",
+			Summary: "List stored and referenced secrets without their values",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("secrets list", "List the secrets in the encrypted file and the ${secret:NAME} references in the template. Values are never shown.")
+				file := fs.String("file", t.File, "secrets file (default: the template's file provider)")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+				t.File = *file
+				return t.list(os.Stdout)
+			},
+		},
+		{
+			Name:    "remove",
+			Summary: "Remove a secret from the encrypted file",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("secrets remove", "Remove a secret from the encrypted secrets file.")
+				name := fs.String("name", "", "secret name (required)")
+				file := fs.String("file", t.File, "secrets file (default: the template's file provider)")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+				if *name == "" {
+					return usagef("secrets remove: --name is required")
+				}
+				t.File = *file
+				return t.remove(*name)
+			},
+		},
+	}
+}
+
+// readSecretValue reads the first line of r.
+func readSecretValue(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read secret value: %w", err)
+	}
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		return "", errors.New("no secret value given on stdin")
+	}
+	return value, nil
+}
+
+// secretsFile returns the file to manage: --file, else the template's first file provider, else
+// the default location. The template is read without rendering, so no secret is resolved.
+func (t *SecretsTask) secretsFile() (string, *repoTemplate, error) {
+	templatePath := t.templatePath()
+	template, err := decodeRepoTemplate(templatePath, templatePath == defaultTemplatePath)
+	if err != nil {
+		return "", nil, err
+	}
+	if t.File != "" {
+		return expandHome(t.File), template, nil
+	}
+	for _, p := range template.Secrets.providers() {
+		if p.Type == secretProviderFile {
+			return p.filePath(), template, nil
+		}
+	}
+	return defaultSecretsFile(), template, nil
+}
+
+func (t *SecretsTask) set(name, value string) error {
+	if !secretNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q (use letters, digits, '.', '_', '-' and '/')", name)
+	}
+	path, _, err := t.secretsFile()
+	if err != nil {
+		return err
+	}
+	secrets, err := readSecretsFile(path)
+	if err != nil {
+		return err
+	}
+	_, replaced := secrets[name]
+	secrets[name] = value
+	if err := writeSecretsFile(path, secrets); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+
+	if replaced {
+		fmt.Printf("Updated secret %s in %s\n", name, path)
+	} else {
+		fmt.Printf("Stored secret %s in %s\n", name, path)
+	}
+	return nil
+}
+
+func (t *SecretsTask) remove(name string) error {
+	path, _, err := t.secretsFile()
+	if err != nil {
+		return err
+	}
+	secrets, err := readSecretsFile(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("secret %q is not stored in %s", name, path)
+	}
+	delete(secrets, name)
+	if err := writeSecretsFile(path, secrets); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	fmt.Printf("Removed secret %s from %s\n", name, path)
+	return nil
+}
+
+// list prints every secret stored in the file or referenced by the template. The file is only
+// opened when it exists, so listing references works before a passphrase is set.
+func (t *SecretsTask) list(w io.Writer) error {
+	path, template, err := t.secretsFile()
+	if err != nil {
+		return err
+	}
+	stored := map[string]string{}
+	exists, err := pathExists(path)
+	if err != nil {
+		return fmt.Errorf("unable to inspect %s: %w", path, err)
+	}
+	if exists {
+		if stored, err = readSecretsFile(path); err != nil {
+			return err
+		}
+	}
+	referenced, err := template.secretReferences()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(stored)+len(referenced))
+	for name := range stored {
+		names = append(names, name)
+	}
+	for name := range referenced {
+		if _, ok := stored[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "Secrets file: %s\n", path)
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No secrets stored or referenced.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTORED\tUSED BY")
+	for _, name := range names {
+		storedText := "no"
+		if _, ok := stored[name]; ok {
+			storedText = "yes"
+		}
+		usedBy := "-"
+		if services := referenced[name]; len(services) > 0 {
+			usedBy = strings.Join(services, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, storedText, usedBy)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	for _, value := range []string{"redact-me-token", "redact-me-token-and-more", "xyz"} {
+		registerSecret(value)
+	}
+
+	for _, tc := range []struct {
+		text string
+		want string
+	}{
+		{"no secrets here", "no secrets here"},
+		{"Authorization: Bearer redact-me-token", "Authorization: Bearer ********"},
+		{"a=redact-me-token b=redact-me-token", "a=******** b=********"},
+		{"redact-me-token-and-more", "********"},
+		{"short values like xyz are left alone", "short values like xyz are left alone"},
+	} {
+		if got := redactSecrets(tc.text); got != tc.want {
+			t.Errorf("redactSecrets(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+
+	var b strings.Builder
+	w := redactingWriter{w: &b}
+	line := "TOKEN=redact-me-token\n"
+	if n, err := w.Write([]byte(line)); err != nil || n != len(line) {
+		t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(line))
+	}
+	if got := b.String(); got != "TOKEN=********\n" {
+		t.Errorf("writer wrote %q", got)
+	}
+
+	for value, want := range map[string]bool{
+		"redact-me-token":          true,
+		"redact-me-token-and-more": true,
+		"xyz":                      false,
+		"plain":                    false,
+	} {
+		if got := isSecretValue(value); got != want {
+			t.Errorf("isSecretValue(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Service states reported by ServicesTask.status.
+const (
+	serviceRunning   = "running"
+	serviceStopped   = "stopped"
+	serviceUnknown   = "unknown"
+	serviceNotCloned = "not cloned"
+)
+
+// ServicesTask starts, stops and reports on the day-to-day lifecycle of cloned services using
+// the start, stop and status commands from the template, falling back to the service's compose
+// stack when it has none.
+type ServicesTask struct {
+	workspaceConfig
+}
+
+// serviceStateReport is one row of the services status table.
+type serviceStateReport struct {
+	Service string
+	State   string
+	Detail  string
+}
+
+func (t *ServicesTask) ID() string {
+	return "services"
+}
+
+func (t *ServicesTask) Name() string {
+	return "Services"
+}
+
+func (t *ServicesTask) Description() string {
+	return "Start, stop, restart and check cloned services in dependency order"
+}
+
+func (t *ServicesTask) Run(ctx context.Context) error {
+	template, order, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		items := []repoMenuItem{
+			{label: "Status of all services", action: func() error { return t.runVerb(ctx, template, "status", "") }},
+			{label: "Start all services", action: func() error { return t.runVerb(ctx, template, "start", "") }},
+			{label: "Stop all services", action: func() error { return t.runVerb(ctx, template, "stop", "") }},
+			{label: "Restart all services", action: func() error { return t.runVerb(ctx, template, "restart", "") }},
+		}
+		items = append(items, repoMenuItem{
+			label: "Explain a service's environment",
+			action: func() error {
+				name, ok := promptService(scanner, order, "Service")
+				if !ok {
+					return nil
+				}
+				t.explainEnv(os.Stdout, template, []string{name})
+				return nil
+			},
+		})
+		for _, verb := range []string{"Start", "Stop", "Restart"} {
+			items = append(items, repoMenuItem{
+				label: verb + " a service",
+				action: func() error {
+					name, ok := promptService(scanner, order, "Service to "+strings.ToLower(verb))
+					if !ok {
+						return nil
+					}
+					return t.runVerb(ctx, template, strings.ToLower(verb), name)
+				},
+			})
+		}
+
+		fmt.Println("\n=== Services ===")
+		for i, item := range items {
+			fmt.Printf("%d. %s\n", i+1, item.label)
+		}
+		backOption := len(items) + 1
+		fmt.Printf("\n%d. Back to main menu\n", backOption)
+		fmt.Print("\nSelect option: ")
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			return errors.New("input stream closed")
+		}
+
+		choice, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		switch {
+		case err != nil:
+			fmt.Println("Please enter a valid number.")
+		case choice >= 1 && choice < backOption:
+			if err := items[choice-1].action(); err != nil {
+				fmt.Printf("Error: %s\n", redactSecrets(err.Error()))
+			}
+		case choice == backOption:
+			return nil
+		default:
+			fmt.Println("Invalid option. Please try again.")
+		}
+	}
+}
+
+// Subcommands exposes the lifecycle actions to the CLI.
+func (t *ServicesTask) Subcommands() []Subcommand {
+	subcommand := func(verb, summary string) Subcommand {
+		return Subcommand{
+			Name:    verb,
+			Summary: summary,
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("services "+verb, summary+".")
+				service := fs.String("service", "", "act on this service only (with its dependencies for start, its dependents for stop)")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+
+				template, _, err := t.loadTemplate()
+				if err != nil {
+					return err
+				}
+				if *service == "" {
+					return t.runVerb(ctx, template, verb, "")
+				}
+				if _, ok := template.Services[*service]; !ok {
+					return usagef("services %s: unknown service %q", verb, *service)
+				}
+				if verb == "status" {
+					return t.status(ctx, os.Stdout, template, []string{*service})
+				}
+				return t.runVerb(ctx, template, verb, *service)
+			},
+		}
+	}
+
+	return []Subcommand{
+		subcommand("start", "Start services in dependency order and wait for their health checks"),
+		subcommand("stop", "Stop services in reverse dependency order"),
+		subcommand("restart", "Stop and then start services"),
+		subcommand("status", "Report whether each service is running"),
+		{
+			Name:    "env",
+			Summary: "Explain each environment variable a service's commands see and where it comes from",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("services env", "List the final value of every variable the template sets or removes for a service's commands, and whether it came from the template, its defaults or your shell.")
+				service := fs.String("service", "", "explain this service only")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+
+				template, order, err := t.loadTemplate()
+				if err != nil {
+					return err
+				}
+				if *service != "" {
+					if _, ok := template.Services[*service]; !ok {
+						return usagef("services env: unknown service %q", *service)
+					}
+					order = []string{*service}
+				}
+				t.explainEnv(os.Stdout, template, order)
+				return nil
+			},
+		},
+	}
+}
+
+// explainEnv prints the environment each of names runs its commands with, secrets redacted.
+func (t *ServicesTask) explainEnv(w io.Writer, template *repoTemplate, names []string) {
+	w = redactingWriter{w}
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, name)
+		printEnvExplanation(w, "  ", template.Services[name].env())
+	}
+}
+
+// runVerb performs verb for one service, or for every service when name is empty. Starting a
+// service starts its dependencies first; stopping one stops the services that depend on it first.
+func (t *ServicesTask) runVerb(ctx context.Context, template *repoTemplate, verb, name string) error {
+	all, err := template.cloneOrder()
+	if err != nil {
+		return err
+	}
+
+	startList, stopList := all, all
+	if name != "" {
+		if startList, err = template.cloneListFor(name); err != nil {
+			return err
+		}
+		if stopList, err = template.dependentsOf(name); err != nil {
+			return err
+		}
+	}
+
+	switch verb {
+	case "start":
+		return t.start(ctx, template, startList)
+	case "stop":
+		return t.stop(ctx, template, stopList)
+	case "restart":
+		if name != "" {
+			// Dependents are stopped with the service, so bring them back up as well.
+			if startList, err = template.cloneListFor(stopList...); err != nil {
+				return err
+			}
+		}
+		if err := t.stop(ctx, template, stopList); err != nil {
+			return err
+		}
+		return t.start(ctx, template, startList)
+	default:
+		return t.status(ctx, os.Stdout, template, all)
+	}
+}
+
+// start runs the start commands of names in order, confirming each service with its health
+// check before moving on. Services that are not cloned are skipped. It stops at the first
+// failure since later services may depend on it.
+func (t *ServicesTask) start(ctx context.Context, template *repoTemplate, names []string) (err error) {
+	console, finish := newRunOutput(os.Stdout, t.targetDir(), "start")
+	defer func() { finish(err) }()
+	if err := t.savePorts(template); err != nil {
+		return err
+	}
+	for _, name := range names {
+		out := newServiceWriter(console, name)
+		err := t.startService(ctx, out, template, name)
+		out.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *ServicesTask) startService(ctx context.Context, out io.Writer, template *repoTemplate, name string) error {
+	repoPath, err := t.servicePath(template, name)
+	if err != nil {
+		return err
+	}
+
+	cloned, err := pathExists(repoPath)
+	switch {
+	case err != nil:
+		return fmt.Errorf("service %q: unable to inspect %s: %w", name, repoPath, err)
+	case !cloned:
+		fmt.Fprintln(out, "not cloned, skipping")
+		return nil
+	}
+
+	svc, err := template.withSecrets(name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(postCloneSteps(svc.Start)) > 0:
+		err = runServiceCommands(ctx, out, repoPath, name, "start", svc.Start, svc.env(), nil)
+	case svc.Compose != nil:
+		err = runCompose(ctx, out, repoPath, name, svc, "up", "--detach")
+	default:
+		fmt.Fprintln(out, "no start commands")
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	if svc.HealthCheck != nil {
+		return runHealthCheck(ctx, out, repoPath, name, svc.HealthCheck, svc.env())
+	}
+	return nil
+}
+
+// stop runs the stop commands of names in reverse order. A failure does not prevent the
+// remaining services from being stopped.
+func (t *ServicesTask) stop(ctx context.Context, template *repoTemplate, names []string) (err error) {
+	console, finish := newRunOutput(os.Stdout, t.targetDir(), "stop")
+	defer func() { finish(err) }()
+	var failures []error
+
+	for _, name := range slices.Backward(names) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		svc := template.Services[name]
+		out := newServiceWriter(console, name)
+		repoPath, err := t.servicePath(template, name)
+		if err != nil {
+			return err
+		}
+
+		cloned, err := pathExists(repoPath)
+		if err != nil {
+			err = fmt.Errorf("service %q: unable to inspect %s: %w", name, repoPath, err)
+		} else if cloned {
+			svc, err = template.withSecrets(name)
+		}
+		switch {
+		case err != nil:
+			failures = append(failures, err)
+		case !cloned:
+			fmt.Fprintln(out, "not cloned, nothing to stop")
+		case len(postCloneSteps(svc.Stop)) > 0:
+			if err := runServiceCommands(ctx, out, repoPath, name, "stop", svc.Stop, svc.env(), nil); err != nil {
+				failures = append(failures, err)
+			}
+		case svc.Compose != nil:
+			if err := runCompose(ctx, out, repoPath, name, svc, "stop"); err != nil {
+				failures = append(failures, err)
+			}
+		default:
+			fmt.Fprintln(out, "no stop commands")
+		}
+		out.Flush()
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d service(s) failed to stop: %w", len(failures), errors.Join(failures...))
+	}
+	return nil
+}
+
+// status reports whether each service is running. A service's status commands decide: it is
+// running when they all succeed. Without status commands a compose stack is running when all of
+// its containers are, and otherwise a single health check attempt is used.
+func (t *ServicesTask) status(ctx context.Context, w io.Writer, template *repoTemplate, names []string) error {
+	reports := make([]serviceStateReport, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		reports = append(reports, t.serviceStatus(ctx, template, name))
+	}
+
+	tw := tabwriter.NewWriter(redactingWriter{w}, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tSTATE\tDETAIL")
+	for _, report := range reports {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", report.Service, report.State, report.Detail)
+	}
+	return tw.Flush()
+}
+
+func (t *ServicesTask) serviceStatus(ctx context.Context, template *repoTemplate, name string) serviceStateReport {
+	report := func(state, format string, args ...any) serviceStateReport {
+		return serviceStateReport{Service: name, State: state, Detail: fmt.Sprintf(format, args...)}
+	}
+
+	svc := template.Services[name]
+	repoPath, err := t.servicePath(template, name)
+	if err != nil {
+		return report(serviceUnknown, "%v", err)
+	}
+	if cloned, err := pathExists(repoPath); err != nil || !cloned {
+		return report(serviceNotCloned, "%s", repoPath)
+	}
+
+	var output bytes.Buffer
+	switch {
+	case len(postCloneSteps(svc.Status)) > 0:
+		svc, err := template.withSecrets(name)
+		if err != nil {
+			return report(serviceUnknown, "%v", err)
+		}
+		err = runServiceCommands(ctx, &output, repoPath, name, "status", svc.Status, svc.env(), nil)
+		detail := lastLine(output.String())
+		switch {
+		case err != nil && detail == "":
+			return report(serviceStopped, "status command failed")
+		case err != nil:
+			return report(serviceStopped, "%s", detail)
+		case detail == "":
+			return report(serviceRunning, "status commands passed")
+		}
+		return report(serviceRunning, "%s", detail)
+	case svc.Compose != nil:
+		containers, err := composeContainers(ctx, repoPath, name, svc)
+		if err != nil {
+			return report(serviceUnknown, "%v", err)
+		}
+		running := 0
+		for _, c := range containers {
+			if c.State == "running" {
+				running++
+			}
+		}
+		switch {
+		case len(containers) == 0:
+			return report(serviceStopped, "no containers")
+		case running < len(containers):
+			return report(serviceStopped, "%d of %d container(s) running", running, len(containers))
+		}
+		return report(serviceRunning, "%d container(s) running", running)
+	case svc.HealthCheck != nil:
+		svc, err := template.withSecrets(name)
+		if err != nil {
+			return report(serviceUnknown, "%v", err)
+		}
+		probe := *svc.HealthCheck
+		probe.Retries = 1
+		if err := runHealthCheck(ctx, &output, repoPath, name, &probe, svc.env()); err != nil {
+			return report(serviceStopped, "health check failed: %s", probe.describe())
+		}
+		return report(serviceRunning, "health check passed: %s", probe.describe())
+	default:
+		return report(serviceUnknown, "no status commands or health check")
+	}
+}
+
+// lastLine returns the last non-blank line of command output, skipping the "status:" echo lines.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range slices.Backward(lines) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "status: ") {
+			return line
+		}
+	}
+	return ""
+}
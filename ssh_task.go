@@ -14,6 +14,10 @@ type SSHKeyTask struct {
 	SearchDir string
 }
 
+func (t *SSHKeyTask) ID() string {
+	return "ssh"
+}
+
 func (t *SSHKeyTask) Name() string {
 	return "List SSH Keys"
 }
@@ -65,6 +69,25 @@ func (t *SSHKeyTask) Run(ctx context.Context) error {
 	return nil
 }
 
+// Subcommands exposes the key listing to the CLI.
+func (t *SSHKeyTask) Subcommands() []Subcommand {
+	return []Subcommand{
+		{
+			Name:    "list",
+			Summary: "Print copy-ready SSH public keys",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("ssh list", "Print copy-ready SSH public keys.")
+				searchDir := fs.String("dir", t.SearchDir, "directory to search for *.pub files (default ~/.ssh)")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+				t.SearchDir = *searchDir
+				return t.Run(ctx)
+			},
+		},
+	}
+}
+
 func (t *SSHKeyTask) resolveSearchDir() (string, error) {
 	if t.SearchDir != "" {
 		return t.SearchDir, nil
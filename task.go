@@ -4,6 +4,9 @@ import "context"
 
 // Task defines the interface that all devtools must implement
 type Task interface {
+	// ID returns the stable identifier used to invoke the task from the command line
+	ID() string
+
 	// Name returns the display name for the menu
 	Name() string
 
@@ -14,6 +17,29 @@ type Task interface {
 	Run(ctx context.Context) error
 }
 
+// CommandTask is implemented by tasks that expose non-interactive subcommands
+type CommandTask interface {
+	Task
+
+	// Subcommands returns the actions available as `devtools <id> <subcommand>`
+	Subcommands() []Subcommand
+}
+
+// FlagTask is implemented by tasks that accept flags directly, as in `devtools <id> [flags]`
+type FlagTask interface {
+	Task
+
+	// RunArgs executes the task with the command-line arguments that followed its ID
+	RunArgs(ctx context.Context, args []string) error
+}
+
+// Subcommand describes a single non-interactive action of a task
+type Subcommand struct {
+	Name    string
+	Summary string
+	Run     func(ctx context.Context, args []string) error
+}
+
 // TaskRegistry manages available tasks
 type TaskRegistry struct {
 	tasks []Task
@@ -43,3 +69,13 @@ func (tr *TaskRegistry) GetTask(index int) Task {
 	}
 	return tr.tasks[index]
 }
+
+// FindTask returns the task registered under the given ID, or nil if none matches
+func (tr *TaskRegistry) FindTask(id string) Task {
+	for _, task := range tr.tasks {
+		if task.ID() == id {
+			return task
+		}
+	}
+	return nil
+}
@@ -8,6 +8,10 @@ import (
 // HelloWorldTask demonstrates the basic task interface
 type HelloWorldTask struct{}
 
+func (h *HelloWorldTask) ID() string {
+	return "hello"
+}
+
 func (h *HelloWorldTask) Name() string {
 	return "Hello world"
 }
@@ -11,6 +11,10 @@ import (
 // SystemInfoTask shows system information
 type SystemInfoTask struct{}
 
+func (s *SystemInfoTask) ID() string {
+	return "sysinfo"
+}
+
 func (s *SystemInfoTask) Name() string {
 	return "SystemInfo"
 
@@ -43,6 +47,10 @@ func (s *SystemInfoTask) Run(ctx context.Context) error {
 // DependencyCheckTask verifies required tools are installed
 type DependancyCheckTask struct{}
 
+func (d *DependancyCheckTask) ID() string {
+	return "deps"
+}
+
 func (d *DependancyCheckTask) Name() string {
 	return "Check Dependencies"
 }
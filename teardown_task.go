@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// TeardownTask runs each service's teardown commands in reverse dependency order and can
+// delete the clones afterwards. A service with a compose stack and no teardown commands has
+// its stack taken down instead.
+type TeardownTask struct {
+	workspaceConfig
+}
+
+// teardownOptions controls what a teardown run removes.
+type teardownOptions struct {
+	// Delete removes the clone directories once their teardown commands have run.
+	Delete bool
+	// Yes skips the confirmation before deleting clones.
+	Yes bool
+	// Force deletes clones even when they cannot be checked for local work.
+	Force bool
+}
+
+func (t *TeardownTask) ID() string {
+	return "teardown"
+}
+
+func (t *TeardownTask) Name() string {
+	return "Teardown Services"
+}
+
+func (t *TeardownTask) Description() string {
+	return "Run teardown commands in reverse dependency order, optionally deleting the clones"
+}
+
+func (t *TeardownTask) Run(ctx context.Context) error {
+	template, order, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Println("\n=== Teardown Services ===")
+	fmt.Println("1. Tear down all services")
+	fmt.Println("2. Tear down one service and everything that depends on it")
+	fmt.Println("3. Back to main menu")
+	fmt.Print("\nSelect option: ")
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		return errors.New("input stream closed")
+	}
+
+	names := order
+	switch strings.TrimSpace(scanner.Text()) {
+	case "1":
+	case "2":
+		name, ok := promptService(scanner, order, "Service to tear down")
+		if !ok {
+			return nil
+		}
+		if names, err = template.dependentsOf(name); err != nil {
+			return err
+		}
+	case "3":
+		return nil
+	default:
+		fmt.Println("Invalid option.")
+		return nil
+	}
+
+	fmt.Print("Also delete the clone directories? [y/N]: ")
+	var opts teardownOptions
+	if scanner.Scan() {
+		answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		opts.Delete = answer == "y" || answer == "yes"
+	}
+
+	return t.teardown(ctx, scanner, template, names, opts)
+}
+
+func (t *TeardownTask) RunArgs(ctx context.Context, args []string) error {
+	fs := newCommandFlags(t.ID(), "Run each service's teardown commands in reverse dependency order. With --service, services that depend on it are torn down first.")
+	service := fs.String("service", "", "tear down only this service and the services that depend on it")
+	var opts teardownOptions
+	fs.BoolVar(&opts.Delete, "delete", false, "delete the clone directories after their teardown commands succeed")
+	fs.BoolVar(&opts.Yes, "yes", false, "delete without asking for confirmation")
+	fs.BoolVar(&opts.Force, "force", false, "also delete clones that cannot be checked for local work")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	if opts.Yes && !opts.Delete {
+		return usagef("teardown: --yes only applies with --delete")
+	}
+	if opts.Force && !opts.Delete {
+		return usagef("teardown: --force only applies with --delete")
+	}
+
+	template, names, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+	if *service != "" {
+		if _, ok := template.Services[*service]; !ok {
+			return usagef("teardown: unknown service %q", *service)
+		}
+		if names, err = template.dependentsOf(*service); err != nil {
+			return err
+		}
+	}
+
+	return t.teardown(ctx, bufio.NewScanner(os.Stdin), template, names, opts)
+}
+
+// teardown runs the teardown commands of the cloned services among names, last clone first.
+// A failing service does not stop independent services, but the services it depends on are
+// left running for it and none of their clones are deleted.
+func (t *TeardownTask) teardown(ctx context.Context, scanner *bufio.Scanner, template *repoTemplate, names []string, opts teardownOptions) (err error) {
+	state, err := loadWorkspaceState(t.targetDir())
+	if err != nil {
+		return err
+	}
+
+	console, finish := newRunOutput(os.Stdout, t.targetDir(), "teardown")
+	defer func() { finish(err) }()
+	var failures []error
+	var tornDown []string
+	// held maps a service to the dependent whose failed teardown still needs it.
+	held := make(map[string]string)
+	hold := func(name, by string) {
+		for _, dep := range template.Services[name].Depends {
+			held[strings.TrimSpace(dep)] = by
+		}
+	}
+
+	for _, name := range slices.Backward(names) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		svc := template.Services[name]
+		out := newServiceWriter(console, name)
+		if by, ok := held[name]; ok {
+			fmt.Fprintf(out, "skipped: %q did not tear down and may still need it\n", by)
+			out.Flush()
+			hold(name, by)
+			continue
+		}
+		repoPath, err := t.servicePath(template, name)
+		if err != nil {
+			return err
+		}
+
+		cloned, err := pathExists(repoPath)
+		if err == nil && cloned {
+			if svc, err = template.withSecrets(name); err != nil {
+				failures = append(failures, err)
+				hold(name, name)
+				continue
+			}
+		}
+		switch {
+		case err != nil:
+			failures = append(failures, fmt.Errorf("service %q: unable to inspect %s: %w", name, repoPath, err))
+			continue
+		case !cloned:
+			fmt.Fprintf(out, "not cloned at %s, nothing to tear down\n", repoPath)
+			out.Flush()
+			continue
+		case len(postCloneSteps(svc.Teardown)) > 0:
+			err = runServiceCommands(ctx, out, repoPath, name, "teardown", svc.Teardown, svc.env(), nil)
+		case svc.Compose != nil:
+			err = runCompose(ctx, out, repoPath, name, svc, "down")
+		default:
+			fmt.Fprintln(out, "no teardown commands")
+			out.Flush()
+			tornDown = append(tornDown, name)
+			continue
+		}
+		out.Flush()
+		if err != nil {
+			failures = append(failures, err)
+			hold(name, name)
+			continue
+		}
+
+		// The service is no longer provisioned; the next clone run repeats its post-clone commands.
+		if err := state.reset(name, true); err != nil {
+			return err
+		}
+		tornDown = append(tornDown, name)
+	}
+
+	if opts.Delete && len(tornDown) > 0 {
+		if err := t.deleteClones(ctx, scanner, state, template, tornDown, opts); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d service(s) failed to tear down: %w", len(failures), errors.Join(failures...))
+	}
+	return nil
+}
+
+// deleteClones lists any work that would be lost, asks for confirmation, then removes the clones.
+// Clones with worktrees are skipped because deleting them would orphan the worktrees, and so are
+// clones that cannot be checked for local work unless opts.Force is set. Nothing outside the
+// workspace, or the workspace itself, is ever deleted.
+func (t *TeardownTask) deleteClones(ctx context.Context, scanner *bufio.Scanner, state *workspaceState, template *repoTemplate, names []string, opts teardownOptions) error {
+	type deletion struct {
+		name string
+		path string
+	}
+	var targets []deletion
+
+	fmt.Println("\nClones to delete:")
+	for _, name := range names {
+		repoPath, err := t.servicePath(template, name)
+		if err != nil {
+			return err
+		}
+		if !strictlyInside(t.targetDir(), repoPath) {
+			fmt.Printf("  %s: kept, it is not inside the workspace %s\n", repoPath, t.targetDir())
+			continue
+		}
+
+		worktrees, err := listWorktrees(ctx, name, repoPath)
+		if err == nil && len(worktrees) > 0 {
+			fmt.Printf("  %s: kept, it has %d worktree(s); remove them with 'devtools worktree remove' first\n", repoPath, len(worktrees))
+			continue
+		}
+
+		status, err := inspectRepo(ctx, repoPath)
+		if err != nil && !opts.Force {
+			fmt.Printf("  %s: kept, unable to check for local work (%v); use --force to delete it anyway\n", repoPath, err)
+			continue
+		}
+		targets = append(targets, deletion{name: name, path: repoPath})
+		fmt.Printf("  %s", repoPath)
+		if err != nil {
+			fmt.Printf(" (unable to check for local work: %v)\n", err)
+			continue
+		}
+		if work := unsavedWork(status); len(work) > 0 {
+			fmt.Printf(" - WILL LOSE %s\n", strings.Join(work, ", "))
+			continue
+		}
+		fmt.Println(" (no local work)")
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+	if !opts.Yes {
+		fmt.Print("\nType 'delete' to remove these directories: ")
+		if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "delete" {
+			fmt.Println("Clones kept.")
+			return nil
+		}
+	}
+
+	for _, target := range targets {
+		if err := os.RemoveAll(target.path); err != nil {
+			return fmt.Errorf("service %q: delete %s: %w", target.name, target.path, err)
+		}
+		if err := state.forget(target.name); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s\n", target.path)
+	}
+	return nil
+}
+
+// strictlyInside reports whether path lies inside dir and is not dir itself.
+func strictlyInside(dir, path string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != "." && filepath.IsLocal(rel)
+}
+
+// unsavedWork describes what exists only in a local clone: uncommitted and untracked files,
+// commits not pushed to the upstream, and branches with no upstream at all.
+func unsavedWork(status repoStatus) []string {
+	var work []string
+	if status.Changed > 0 {
+		work = append(work, fmt.Sprintf("%d uncommitted change(s)", status.Changed))
+	}
+	if status.Untracked > 0 {
+		work = append(work, fmt.Sprintf("%d untracked file(s)", status.Untracked))
+	}
+	switch {
+	case status.Ahead > 0:
+		work = append(work, fmt.Sprintf("%d unpushed commit(s) on %s", status.Ahead, status.Branch))
+	case !status.Detached && status.Upstream == "":
+		work = append(work, fmt.Sprintf("branch %s which has no upstream", status.Branch))
+	}
+	return work
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestTeardownTakesComposeStacksDown(t *testing.T) {
+	log := fakeDocker(t)
+	targetDir := t.TempDir()
+	writeClone(t, targetDir, "db", nil)
+	writeClone(t, targetDir, "api", nil)
+	template := testTemplate(t, `
+services:
+  db:
+    clone: { repo: https://example.com/db.git }
+    compose: { project: db }
+  api:
+    clone: { repo: https://example.com/api.git }
+    depends: [db]
+    compose: { project: api }
+    teardown:
+      - echo "api teardown" >> "$FAKE_DOCKER_LOG"
+`)
+	state, err := loadWorkspaceState(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"db", "api"} {
+		if err := state.update(name, func(entry *serviceState) { *entry = serviceState{Cloned: true, Healthy: true} }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	task := &TeardownTask{workspaceConfig{TargetDir: targetDir}}
+	if err := task.teardown(context.Background(), nil, template, []string{"db", "api"}, teardownOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// api's own teardown commands replace compose down; db has none, so its stack is taken down.
+	want := []string{
+		"api teardown",
+		"db compose -p db down",
+	}
+	if got := dockerCalls(t, log); !slices.Equal(got, want) {
+		t.Errorf("teardown ran %q, want %q", got, want)
+	}
+
+	state, err = loadWorkspaceState(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"db", "api"} {
+		if progress, _ := state.service(name); progress.Healthy {
+			t.Errorf("%s is still recorded as provisioned after teardown", name)
+		}
+	}
+}
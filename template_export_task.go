@@ -4,14 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
-// TemplateExportTask writes the embedded template to disk for developers to customise.
+// TemplateExportTask writes the embedded template to disk for developers to customise, and shows the
+// active template rendered or broken down by layer.
 type TemplateExportTask struct {
-	Destination string
+	Destination  string
+	TemplatePath string
+}
+
+func (t *TemplateExportTask) ID() string {
+	return "template"
 }
 
 func (t *TemplateExportTask) Name() string {
@@ -19,7 +28,7 @@ func (t *TemplateExportTask) Name() string {
 }
 
 func (t *TemplateExportTask) Description() string {
-	return "Write embedded template.yml to exported_template.yml"
+	return "Export the embedded template, render the active template or show its layers"
 }
 
 func (t *TemplateExportTask) Run(ctx context.Context) error {
@@ -46,6 +55,77 @@ func (t *TemplateExportTask) Run(ctx context.Context) error {
 	return nil
 }
 
+// Subcommands exposes the template export to the CLI.
+func (t *TemplateExportTask) Subcommands() []Subcommand {
+	return []Subcommand{
+		{
+			Name:    "export",
+			Summary: "Write the embedded template to disk",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("template export", "Write the embedded template to disk.")
+				out := fs.String("out", t.Destination, "destination file (default template_<date>.yml)")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+				t.Destination = *out
+				return t.Run(ctx)
+			},
+		},
+		{
+			Name:    "render",
+			Summary: "Print the template with defaults applied and ${VAR} references resolved",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("template render", "Print the active template with defaults applied and ${VAR} references resolved.")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+				return t.render(os.Stdout)
+			},
+		},
+		{
+			Name:    "layers",
+			Summary: "Show the template layers and which file each value came from",
+			Run: func(ctx context.Context, args []string) error {
+				fs := newCommandFlags("template layers", "Show the template layers in merge order and the file each value came from.")
+				if err := parseCommandFlags(fs, args); err != nil {
+					return err
+				}
+
+				layers, err := loadTemplateLayers(t.templatePath(), t.templatePath() == defaultTemplatePath)
+				if err != nil {
+					return err
+				}
+				layers.printSources(os.Stdout)
+				return nil
+			},
+		},
+	}
+}
+
+func (t *TemplateExportTask) templatePath() string {
+	if t.TemplatePath != "" {
+		return t.TemplatePath
+	}
+	return defaultTemplatePath
+}
+
+// render writes the fully-rendered active template as YAML.
+func (t *TemplateExportTask) render(w io.Writer) error {
+	path := t.templatePath()
+	template, err := loadRepoTemplate(path, path == defaultTemplatePath)
+	if err != nil {
+		return err
+	}
+	template.Vars = nil
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(template); err != nil {
+		return fmt.Errorf("encode template: %w", err)
+	}
+	return enc.Close()
+}
+
 func (t *TemplateExportTask) destinationPath() string {
 	if t.Destination != "" {
 		return t.Destination
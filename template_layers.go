@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	includeKey          = "include"
+	userOverrideFile    = "override.yml"
+	localOverrideSuffix = ".local"
+	// embeddedInclude is the include entry that merges the whole embedded default.
+	embeddedInclude = "embedded"
+)
+
+// embeddedBaseKeys are the parts of the embedded default a team file inherits without
+// `include: embedded`: shared settings, but none of its services or profiles.
+var embeddedBaseKeys = []string{"vars", "defaults"}
+
+// templateLayer is one file that may contribute to the active template. Note, when set, says
+// which part of a loaded file was used.
+type templateLayer struct {
+	Kind   string
+	Path   string
+	Loaded bool
+	Note   string
+}
+
+// layeredTemplate is the single document produced by deep-merging every layer and include.
+// Layers apply in order: the embedded default (only its vars and defaults when a team file
+// exists), the team file, the user override at ~/.config/devtools/override.yml, then
+// <template>.local.yml next to the team file. Within a file, its includes are merged first and
+// the file itself on top.
+//
+// Merge rules: mappings merge key by key, a null value deletes the key, and lists and scalars
+// from the later layer replace the earlier value outright.
+type layeredTemplate struct {
+	Root    *yaml.Node
+	Layers  []templateLayer
+	Files   []string
+	origins map[*yaml.Node]string
+}
+
+// templateParseError is a YAML syntax or structure error in one of the layer files.
+type templateParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *templateParseError) Error() string {
+	return templateIssue(*e).String()
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// loadTemplateLayers reads and merges every layer for the team template at path. A missing team
+// file is an error unless allowEmbedded is set, in which case the embedded default stands alone.
+// Otherwise the team file inherits only the embedded vars and defaults; its services and profiles
+// come in with `include: embedded`.
+func loadTemplateLayers(path string, allowEmbedded bool) (*layeredTemplate, error) {
+	lt := &layeredTemplate{origins: map[*yaml.Node]string{}}
+
+	team := templateLayer{Kind: "team", Path: path}
+	contents, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		team.Loaded = true
+	case allowEmbedded && errors.Is(err, os.ErrNotExist):
+		if len(embeddedTemplate) == 0 {
+			return nil, fmt.Errorf("template %q not found and no embedded default available", path)
+		}
+		fmt.Fprintf(os.Stderr, "template %q not found, using embedded default\n", path)
+	default:
+		return nil, fmt.Errorf("read template %q: %w", path, err)
+	}
+
+	if len(embeddedTemplate) > 0 {
+		embedded := templateLayer{Kind: "embedded", Path: embeddedTemplateName, Loaded: true}
+		root, err := parseTemplateFile(embeddedTemplateName, embeddedTemplate)
+		if err != nil {
+			return nil, err
+		}
+		if team.Loaded {
+			keepKeys(root, embeddedBaseKeys...)
+			embedded.Note = strings.Join(embeddedBaseKeys, " and ") + " only"
+		}
+		lt.Layers = append(lt.Layers, embedded)
+		if err := lt.addRoot(embeddedTemplateName, root, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	lt.Layers = append(lt.Layers, team)
+	if team.Loaded {
+		if err := lt.addFile(path, contents, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	overlays := []templateLayer{{Kind: "local", Path: localOverridePath(path)}}
+	if userPath, err := userOverridePath(); err == nil {
+		overlays = append([]templateLayer{{Kind: "user", Path: userPath}}, overlays...)
+	}
+
+	for _, layer := range overlays {
+		contents, err := os.ReadFile(layer.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			lt.Layers = append(lt.Layers, layer)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s override %q: %w", layer.Kind, layer.Path, err)
+		}
+		layer.Loaded = true
+		lt.Layers = append(lt.Layers, layer)
+		if err := lt.addFile(layer.Path, contents, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return lt, nil
+}
+
+// userOverridePath returns the per-user override file, honouring XDG_CONFIG_HOME.
+func userOverridePath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "devtools", userOverrideFile), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "devtools", userOverrideFile), nil
+}
+
+// localOverridePath returns the per-checkout override next to the team file, e.g. template.local.yml.
+func localOverridePath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + localOverrideSuffix + ext
+}
+
+// keepKeys drops every top-level entry of the mapping root except keys.
+func keepKeys(root *yaml.Node, keys ...string) {
+	kept := root.Content[:0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if slices.Contains(keys, root.Content[i].Value) {
+			kept = append(kept, root.Content[i], root.Content[i+1])
+		}
+	}
+	root.Content = kept
+}
+
+// addFile parses a layer file, merges its includes, then merges the file itself.
+func (lt *layeredTemplate) addFile(name string, contents []byte, stack []string) error {
+	root, err := parseTemplateFile(name, contents)
+	if err != nil {
+		return err
+	}
+	return lt.addRoot(name, root, stack)
+}
+
+// addRoot is addFile for a file that has already been parsed. An include of "embedded" merges the
+// whole embedded default.
+func (lt *layeredTemplate) addRoot(name string, root *yaml.Node, stack []string) error {
+	lt.Files = append(lt.Files, name)
+	lt.track(root, name)
+
+	includes, err := takeIncludes(name, root)
+	if err != nil {
+		return err
+	}
+
+	stack = append(stack, name)
+	for _, inc := range includes {
+		if inc.Value == embeddedInclude {
+			if len(embeddedTemplate) == 0 {
+				return lt.errorAt(inc, "include %q: no embedded default available", inc.Value)
+			}
+			if err := lt.addFile(embeddedTemplateName, embeddedTemplate, stack); err != nil {
+				return err
+			}
+			continue
+		}
+
+		incPath := inc.Value
+		if strings.HasPrefix(incPath, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				incPath = filepath.Join(home, incPath[2:])
+			}
+		}
+		if !filepath.IsAbs(incPath) && name != embeddedTemplateName {
+			incPath = filepath.Join(filepath.Dir(name), incPath)
+		}
+
+		for _, seen := range stack {
+			if seen == incPath {
+				return lt.errorAt(inc, "include cycle: %s -> %s", strings.Join(stack, " -> "), incPath)
+			}
+		}
+
+		incContents, err := os.ReadFile(incPath)
+		if err != nil {
+			return lt.errorAt(inc, "include %q: %v", inc.Value, err)
+		}
+		if err := lt.addFile(incPath, incContents, stack); err != nil {
+			return err
+		}
+	}
+
+	if lt.Root == nil {
+		lt.Root = root
+		return nil
+	}
+	lt.Root = mergeNodes(lt.Root, root)
+	return nil
+}
+
+// parseTemplateFile returns the top-level mapping of a template file.
+func parseTemplateFile(name string, contents []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(contents, &doc); err != nil {
+		parseErr := &templateParseError{File: name, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+		if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			parseErr.Line, _ = strconv.Atoi(m[1])
+			parseErr.Message = m[2]
+		}
+		return nil, parseErr
+	}
+
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, &templateParseError{File: name, Line: root.Line, Column: root.Column, Message: "template must be a mapping"}
+	}
+	return root, nil
+}
+
+// takeIncludes removes the include key from root and returns the listed paths.
+func takeIncludes(name string, root *yaml.Node) ([]*yaml.Node, error) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != includeKey {
+			continue
+		}
+		val := root.Content[i+1]
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+
+		switch val.Kind {
+		case yaml.ScalarNode:
+			if val.Tag == "!!null" {
+				return nil, nil
+			}
+			return []*yaml.Node{val}, nil
+		case yaml.SequenceNode:
+			for _, item := range val.Content {
+				if item.Kind != yaml.ScalarNode || item.Value == "" {
+					return nil, &templateParseError{File: name, Line: item.Line, Column: item.Column, Message: "include entries must be file paths"}
+				}
+			}
+			return val.Content, nil
+		default:
+			return nil, &templateParseError{File: name, Line: val.Line, Column: val.Column, Message: "include must be a file path or a list of file paths"}
+		}
+	}
+	return nil, nil
+}
+
+// mergeNodes deep-merges src over dst and returns the result.
+func mergeNodes(dst, src *yaml.Node) *yaml.Node {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return src
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, val := src.Content[i], src.Content[i+1]
+
+		idx := -1
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				idx = j
+				break
+			}
+		}
+
+		switch {
+		case val.Tag == "!!null" && idx >= 0:
+			dst.Content = append(dst.Content[:idx], dst.Content[idx+2:]...)
+		case val.Tag == "!!null":
+		case idx < 0:
+			dst.Content = append(dst.Content, key, val)
+		default:
+			dst.Content[idx+1] = mergeNodes(dst.Content[idx+1], val)
+		}
+	}
+	return dst
+}
+
+func (lt *layeredTemplate) track(node *yaml.Node, file string) {
+	if node == nil {
+		return
+	}
+	lt.origins[node] = file
+	for _, child := range node.Content {
+		lt.track(child, file)
+	}
+}
+
+// origin returns the file node was read from.
+func (lt *layeredTemplate) origin(node *yaml.Node) string {
+	if file, ok := lt.origins[node]; ok {
+		return file
+	}
+	if len(lt.Files) > 0 {
+		return lt.Files[0]
+	}
+	return ""
+}
+
+func (lt *layeredTemplate) errorAt(node *yaml.Node, format string, args ...any) error {
+	return &templateParseError{File: lt.origin(node), Line: node.Line, Column: node.Column, Message: fmt.Sprintf(format, args...)}
+}
+
+// printSources lists every loaded layer, then each value of the merged template with the file it came from.
+func (lt *layeredTemplate) printSources(w io.Writer) {
+	fmt.Fprintln(w, "Layers (later layers override earlier ones):")
+	for i, layer := range lt.Layers {
+		status := "loaded"
+		switch {
+		case !layer.Loaded:
+			status = "not found"
+		case layer.Note != "":
+			status = layer.Note
+		}
+		fmt.Fprintf(w, "  %d. %-8s %s (%s)\n", i+1, layer.Kind, layer.Path, status)
+	}
+	if len(lt.Files) > len(lt.Layers) {
+		fmt.Fprintln(w, "\nFiles merged, including includes:")
+		for _, file := range lt.Files {
+			fmt.Fprintf(w, "  - %s\n", file)
+		}
+	}
+
+	fmt.Fprintln(w, "\nValues:")
+	lt.printNode(w, lt.Root, "")
+}
+
+func (lt *layeredTemplate) printNode(w io.Writer, node *yaml.Node, path string) {
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			lt.printNode(w, node.Content[i+1], joinPath(path, node.Content[i].Value))
+		}
+		return
+	}
+
+	value := node.Value
+	if node.Kind != yaml.ScalarNode {
+		flow := *node
+		flow.Style = yaml.FlowStyle
+		if out, err := yaml.Marshal(&flow); err == nil {
+			value = strings.TrimSpace(string(out))
+		}
+	}
+	fmt.Fprintf(w, "  %s = %s  [%s:%d]\n", path, value, lt.origin(node), node.Line)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlValue decodes text into plain Go values for comparison.
+func yamlValue(t *testing.T, text string) any {
+	t.Helper()
+	var v any
+	if err := yaml.Unmarshal([]byte(text), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMergeNodes(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		dst, src string
+		want     string
+	}{
+		{"new keys are added", "a: 1", "b: 2", "{a: 1, b: 2}"},
+		{"scalars are replaced", "a: 1\nb: 2", "a: 3", "{a: 3, b: 2}"},
+		{"mappings merge key by key", "svc: {branch: main, env: {A: x, B: y}}", "svc: {env: {B: z, C: w}}", "svc: {branch: main, env: {A: x, B: z, C: w}}"},
+		{"lists are replaced", "cmds: [a, b, c]", "cmds: [d]", "cmds: [d]"},
+		{"null removes a key", "svc: {depends: [db], branch: main}", "svc: {depends: ~}", "svc: {branch: main}"},
+		{"null for a missing key is ignored", "a: 1", "b: ~", "a: 1"},
+		{"a mapping replaces a scalar", "clone: git clone x", "clone: {repo: x}", "clone: {repo: x}"},
+		{"a scalar replaces a mapping", "clone: {repo: x}", "clone: git clone x", "clone: git clone x"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dst, err := parseTemplateFile("dst.yml", []byte(tc.dst))
+			if err != nil {
+				t.Fatal(err)
+			}
+			src, err := parseTemplateFile("src.yml", []byte(tc.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := yaml.Marshal(mergeNodes(dst, src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := yamlValue(t, string(out)), yamlValue(t, tc.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("merged to %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplateLayersEmbeddedDefault(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	write := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	var embedded struct {
+		Vars     map[string]string `yaml:"vars"`
+		Services map[string]any    `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(embeddedTemplate, &embedded); err != nil {
+		t.Fatal(err)
+	}
+	embeddedServices := slices.Collect(maps.Keys(embedded.Services))
+
+	for _, tc := range []struct {
+		name          string
+		path          string
+		allowEmbedded bool
+		wantServices  []string
+	}{
+		{"team file keeps its own services", write("team.yml", "services:\n  a: {clone: git clone x}\n"), false, []string{"a"}},
+		{"include embedded adds its services", write("inc.yml", "include: embedded\nservices:\n  a: {clone: git clone x}\n"), false, append([]string{"a"}, embeddedServices...)},
+		{"missing default template uses the embedded one", filepath.Join(dir, "missing.yml"), true, embeddedServices},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lt, err := loadTemplateLayers(tc.path, tc.allowEmbedded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var merged struct {
+				Vars     map[string]string `yaml:"vars"`
+				Services map[string]any    `yaml:"services"`
+			}
+			if err := lt.Root.Decode(&merged); err != nil {
+				t.Fatal(err)
+			}
+			services := slices.Sorted(maps.Keys(merged.Services))
+			if !slices.Equal(services, slices.Sorted(slices.Values(tc.wantServices))) {
+				t.Errorf("services = %q, want %q", services, tc.wantServices)
+			}
+			if !reflect.DeepEqual(merged.Vars, embedded.Vars) {
+				t.Errorf("vars = %v, want the embedded vars %v", merged.Vars, embedded.Vars)
+			}
+		})
+	}
+
+	if _, err := loadTemplateLayers(filepath.Join(dir, "missing.yml"), false); err == nil {
+		t.Error("a missing --template file was accepted")
+	}
+}
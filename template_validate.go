@@ -0,0 +1,708 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateIssue is a single problem found while validating a template.
+type templateIssue struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (i templateIssue) String() string {
+	switch {
+	case i.Line == 0:
+		return fmt.Sprintf("%s: %s", i.File, i.Message)
+	case i.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", i.File, i.Line, i.Column, i.Message)
+	}
+}
+
+// templateValidator collects issues for a merged template document.
+type templateValidator struct {
+	layers *layeredTemplate
+	issues []templateIssue
+}
+
+func (v *templateValidator) addf(node *yaml.Node, format string, args ...any) {
+	issue := templateIssue{File: v.layers.origin(node), Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		issue.Line = node.Line
+		issue.Column = node.Column
+	}
+	v.issues = append(v.issues, issue)
+}
+
+// validateTemplate strictly checks a merged template: unknown keys, value types, durations, clone
+// command shape, health checks, dependency references and cycles. Every problem is reported
+// with the file, line and column it came from rather than stopping at the first one.
+func validateTemplate(layers *layeredTemplate) []templateIssue {
+	v := &templateValidator{layers: layers}
+	root := layers.Root
+
+	v.checkShape(root, reflect.TypeOf(repoTemplate{}), "")
+
+	var tpl repoTemplate
+	if err := root.Decode(&tpl); err != nil {
+		// Type errors were reported by checkShape; the remaining checks need a decoded template.
+		if len(v.issues) == 0 {
+			v.addf(root, "%s", cleanDecodeError(err))
+		}
+		return v.issues
+	}
+
+	v.checkServices(root, &tpl)
+	v.checkProfiles(root, &tpl)
+	if tpl.PortRange != "" {
+		if _, _, err := parsePortRange(tpl.PortRange); err != nil {
+			_, node := mappingEntry(root, "portRange")
+			v.addf(node, "portRange: %v", err)
+		}
+	}
+
+	if tpl.Secrets != nil {
+		secretsKey, secretsNode := mappingEntry(root, "secrets")
+		providersKey, providersNode := mappingEntry(secretsNode, "providers")
+		for i, p := range tpl.Secrets.Providers {
+			if err := p.check(); err != nil {
+				v.addf(listItem(providersNode, i, cmp.Or(providersKey, secretsKey, root)), "secrets.providers.%d: %v", i, err)
+			}
+		}
+	}
+
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		if v.issues[i].File != v.issues[j].File {
+			return v.issues[i].File < v.issues[j].File
+		}
+		if v.issues[i].Line != v.issues[j].Line {
+			return v.issues[i].Line < v.issues[j].Line
+		}
+		return v.issues[i].Column < v.issues[j].Column
+	})
+	return v.issues
+}
+
+// extensionPrefix marks top-level keys the template ignores, such as x-base holding an anchor
+// that services merge in with `<<: *base`.
+const extensionPrefix = "x-"
+
+var yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkShape walks node alongside the Go type it decodes into, reporting unknown keys and
+// values of the wrong kind. Types with custom YAML decoding validate themselves via Decode,
+// except when written as a mapping of their own fields.
+func (v *templateValidator) checkShape(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// A mapping is still checked field by field when the type also accepts a shorthand scalar.
+	if reflect.PointerTo(t).Implements(yamlUnmarshalerType) && (node.Kind != yaml.MappingNode || t.Kind() != reflect.Struct) {
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			v.addf(node, "%s%s", pathPrefix(path), cleanDecodeError(err))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			v.addf(node, "%sexpected a mapping, got %s", pathPrefix(path), describeNode(node))
+			return
+		}
+		fields := yamlFields(t)
+		content := mappingContent(node)
+		for i := 0; i+1 < len(content); i += 2 {
+			key, val := content[i], content[i+1]
+			field, ok := fields[key.Value]
+			if !ok && path == "" && strings.HasPrefix(key.Value, extensionPrefix) {
+				continue
+			}
+			if !ok {
+				v.addf(key, "%sunknown field %q%s", pathPrefix(path), key.Value, suggestField(key.Value, fields))
+				continue
+			}
+			v.checkShape(val, field.Type, joinPath(path, key.Value))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			v.addf(node, "%sexpected a mapping, got %s", pathPrefix(path), describeNode(node))
+			return
+		}
+		content := mappingContent(node)
+		for i := 0; i+1 < len(content); i += 2 {
+			key, val := content[i], content[i+1]
+			v.checkShape(val, t.Elem(), joinPath(path, key.Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			v.addf(node, "%sexpected a list, got %s", pathPrefix(path), describeNode(node))
+			return
+		}
+		for i, item := range node.Content {
+			v.checkShape(item, t.Elem(), fmt.Sprintf("%s[%d]", pathPrefix(path), i))
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			v.addf(node, "%sexpected %s, got %s", pathPrefix(path), describeKind(t), describeNode(node))
+			return
+		}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			v.addf(node, "%sexpected %s, got %q", pathPrefix(path), describeKind(t), node.Value)
+		}
+	}
+}
+
+// checkServices validates each service's clone command, health check and dependencies, then
+// looks for dependency cycles.
+func (v *templateValidator) checkServices(root *yaml.Node, tpl *repoTemplate) {
+	servicesKey, servicesNode := mappingEntry(root, "services")
+	if len(tpl.Services) == 0 {
+		target := servicesKey
+		if target == nil {
+			target = root
+		}
+		v.addf(target, "template has no services defined")
+		return
+	}
+
+	_, defaultsNode := mappingEntry(root, "defaults")
+	reported := make(map[*yaml.Node]bool)
+
+	for _, name := range sortedServiceNames(tpl) {
+		svc := cloneRepoService(tpl.Services[name])
+		svc.Environment = tpl.serviceEnvironment(svc)
+		svc.EnvPolicy = tpl.Defaults.EnvPolicy.merge(svc.EnvPolicy)
+		keyNode, svcNode := mappingEntry(servicesNode, name)
+		path := "services." + name
+
+		// Report every unresolved ${VAR}, then continue with the rendered values where possible.
+		scope := newVarScope(tpl.Vars, maps.Clone(svc.Environment))
+		scope.policy = svc.EnvPolicy
+		_ = interpolatedFields(&svc, func(fieldPath []string, value *string) error {
+			expanded, err := scope.expand(*value)
+			if err == nil {
+				*value = expanded
+				return nil
+			}
+			node := nodeAtPath(svcNode, fieldPath)
+			if node == nil {
+				node = nodeAtPath(defaultsNode, fieldPath)
+			}
+			if node == nil {
+				node = keyNode
+			}
+			if !reported[node] {
+				reported[node] = true
+				v.addf(node, "%s.%s: %v", path, strings.Join(fieldPath, "."), err)
+			}
+			return nil
+		})
+
+		cloneKey, cloneNode := mappingEntry(svcNode, "clone")
+		if cloneNode == nil || (cloneNode.Kind != yaml.MappingNode && svc.Clone.empty()) {
+			target := cloneKey
+			if target == nil {
+				target = keyNode
+			}
+			v.addf(target, "%s: clone is required", path)
+		} else if _, err := parseCloneCommand(name, svc.Clone); err != nil {
+			target := cloneNode
+			if _, dirNode := mappingEntry(cloneNode, "dir"); dirNode != nil && strings.Contains(err.Error(), "clone dir") {
+				target = dirNode
+			}
+			v.addf(target, "%s.clone: %s", path, strings.TrimPrefix(err.Error(), fmt.Sprintf("service %q: ", name)))
+		}
+
+		if _, err := svc.pin(); err != nil {
+			target := keyNode
+			for _, key := range []string{"commit", "tag", "branch"} {
+				if _, node := mappingEntry(svcNode, key); node != nil {
+					target = node
+					break
+				}
+			}
+			v.addf(target, "%s: %v", path, err)
+		}
+
+		if svc.EnvPolicy != nil {
+			_, policyNode := mappingEntry(svcNode, "envPolicy")
+			_, defaultPolicyNode := mappingEntry(defaultsNode, "envPolicy")
+			v.checkEnvPolicy([]*yaml.Node{policyNode, defaultPolicyNode, keyNode}, svc.EnvPolicy, svc.Environment, path+".envPolicy")
+		}
+
+		if svc.HealthCheck != nil {
+			_, healthNode := mappingEntry(svcNode, "healthCheck")
+			v.checkHealth(healthNode, svc.HealthCheck, path+".healthCheck")
+		}
+
+		portsKey, portsNode := mappingEntry(svcNode, "ports")
+		for i, port := range svc.Ports {
+			// Assigned ports are only known once a workspace renders the template.
+			if strings.Contains(port, "${"+portRefPrefix) {
+				continue
+			}
+			itemNode := listItem(portsNode, i, cmp.Or(portsKey, keyNode))
+			if _, err := parsePort(port); err != nil && !reported[itemNode] {
+				v.addf(itemNode, "%s.ports: %v", path, err)
+			}
+		}
+
+		if svc.EnvFile != nil {
+			_, envFileNode := mappingEntry(svcNode, "envFile")
+			for _, field := range []struct{ key, value string }{
+				{"path", svc.EnvFile.Path},
+				{"example", svc.EnvFile.Example},
+			} {
+				if escapesClone(field.value) {
+					target := envFileNode
+					if _, node := mappingEntry(envFileNode, field.key); node != nil {
+						target = node
+					}
+					v.addf(target, "%s.envFile.%s: %q must be relative to the clone", path, field.key, field.value)
+				}
+			}
+		}
+
+		if svc.Compose != nil {
+			_, composeNode := mappingEntry(svcNode, "compose")
+			v.checkCompose(composeNode, svc.Compose, path+".compose")
+		}
+
+		dependsKey, dependsNode := mappingEntry(svcNode, "depends")
+		for i, dep := range svc.Depends {
+			dep = strings.TrimSpace(dep)
+			if dep == "" {
+				continue
+			}
+			itemNode := listItem(dependsNode, i, cmp.Or(dependsKey, keyNode))
+			switch {
+			case dep == name:
+				v.addf(itemNode, "%s.depends: service cannot depend on itself", path)
+			case !hasService(tpl, dep):
+				v.addf(itemNode, "%s.depends: unknown service %q", path, dep)
+			}
+		}
+	}
+
+	for _, cycle := range dependencyCycles(tpl) {
+		keyNode, _ := mappingEntry(servicesNode, cycle[0])
+		v.addf(keyNode, "circular dependency: %s", strings.Join(cycle, " -> "))
+	}
+}
+
+func (v *templateValidator) checkHealth(node *yaml.Node, cfg *serviceHealth, path string) {
+	at := func(key string) *yaml.Node {
+		if _, val := mappingEntry(node, key); val != nil {
+			return val
+		}
+		return node
+	}
+
+	if _, err := cfg.kind(); err != nil {
+		v.addf(at("type"), "%s: %v", path, err)
+	}
+	for _, key := range []string{"interval", "timeout"} {
+		_, val := mappingEntry(node, key)
+		if val == nil || val.Tag == "!!null" {
+			continue
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(val.Value))
+		switch {
+		case err != nil:
+			v.addf(val, "%s.%s: invalid duration %q (use a Go duration such as 5s or 1m30s)", path, key, val.Value)
+		case d <= 0:
+			v.addf(val, "%s.%s: must be greater than zero", path, key)
+		}
+	}
+	if cfg.Retries < 0 {
+		v.addf(at("retries"), "%s.retries: must not be negative", path)
+	}
+	if cfg.Status != 0 && (cfg.Status < 100 || cfg.Status > 599) {
+		v.addf(at("status"), "%s.status: %d is not an HTTP status code", path, cfg.Status)
+	}
+	if cfg.BodyRegex != "" {
+		if _, err := regexp.Compile(cfg.BodyRegex); err != nil {
+			v.addf(at("bodyRegex"), "%s.bodyRegex: %v", path, err)
+		}
+	}
+}
+
+func (v *templateValidator) checkCompose(node *yaml.Node, cfg *composeConfig, path string) {
+	filesKey, filesNode := mappingEntry(node, "files")
+	for i, file := range cfg.Files {
+		file = strings.TrimSpace(file)
+		switch {
+		case file == "":
+			v.addf(listItem(filesNode, i, cmp.Or(filesKey, node)), "%s.files: file path must not be empty", path)
+		case escapesClone(file):
+			v.addf(listItem(filesNode, i, cmp.Or(filesKey, node)), "%s.files: %q must be relative to the clone", path, file)
+		}
+	}
+	profilesKey, profilesNode := mappingEntry(node, "profiles")
+	for i, profile := range cfg.Profiles {
+		if strings.TrimSpace(profile) == "" {
+			v.addf(listItem(profilesNode, i, cmp.Or(profilesKey, node)), "%s.profiles: profile name must not be empty", path)
+		}
+	}
+	if cfg.Project != "" && !composeProjectPattern.MatchString(cfg.Project) {
+		_, projectNode := mappingEntry(node, "project")
+		v.addf(projectNode, "%s.project: %q must contain only lowercase letters, digits, dashes and underscores, starting with a letter or digit", path, cfg.Project)
+	}
+}
+
+// checkEnvPolicy checks a service's envPolicy, merged with the defaults, against its merged
+// environment. Problems are reported at the first of nodes that mentions the offending key.
+func (v *templateValidator) checkEnvPolicy(nodes []*yaml.Node, policy *envPolicy, env map[string]string, path string) {
+	at := func(list, key string) *yaml.Node {
+		for _, node := range nodes {
+			_, listNode := mappingEntry(node, list)
+			if listNode == nil {
+				continue
+			}
+			for _, item := range listNode.Content {
+				if item.Value == key {
+					return item
+				}
+			}
+		}
+		return nodes[len(nodes)-1]
+	}
+
+	for _, list := range []struct {
+		key  string
+		keys []string
+	}{
+		{"force", policy.Force},
+		{"unset", policy.Unset},
+		{"inherit", policy.Inherit},
+	} {
+		for _, key := range list.keys {
+			if !varNamePattern.MatchString(key) {
+				v.addf(at(list.key, key), "%s.%s: %q is not a valid variable name", path, list.key, key)
+			}
+		}
+	}
+	for _, key := range policy.Force {
+		if _, ok := env[key]; !ok && varNamePattern.MatchString(key) {
+			v.addf(at("force", key), "%s.force: %q is not set in environment", path, key)
+		}
+	}
+	for _, key := range policy.Unset {
+		if _, ok := env[key]; ok {
+			v.addf(at("unset", key), "%s.unset: %q is also set in environment", path, key)
+		}
+	}
+	if len(policy.Inherit) > 0 && !policy.isolated() {
+		v.addf(at("inherit", policy.Inherit[0]), "%s.inherit: only applies with isolate: true", path)
+	}
+}
+
+// escapesClone reports whether a path from the template points outside the service's clone.
+func escapesClone(file string) bool {
+	file = strings.TrimSpace(file)
+	return filepath.IsAbs(file) || file == ".." || strings.HasPrefix(filepath.Clean(file), ".."+string(filepath.Separator))
+}
+
+func (v *templateValidator) checkProfiles(root *yaml.Node, tpl *repoTemplate) {
+	_, profilesNode := mappingEntry(root, "profiles")
+	for _, profile := range tpl.profileNames() {
+		keyNode, membersNode := mappingEntry(profilesNode, profile)
+		if len(tpl.Profiles[profile]) == 0 {
+			v.addf(keyNode, "profiles.%s: profile has no services", profile)
+			continue
+		}
+		for i, member := range tpl.Profiles[profile] {
+			member = strings.TrimSpace(member)
+			if !hasService(tpl, member) {
+				v.addf(listItem(membersNode, i, keyNode), "profiles.%s: unknown service %q", profile, member)
+			}
+		}
+	}
+}
+
+// dependencyCycles returns each distinct dependency cycle, starting from its alphabetically first service.
+func dependencyCycles(tpl *repoTemplate) [][]string {
+	var cycles [][]string
+	seen := make(map[string]bool)
+	state := make(map[string]int) // 0 unvisited, 1 in progress, 2 done
+	var stack []string
+
+	var visit func(string)
+	visit = func(name string) {
+		state[name] = 1
+		stack = append(stack, name)
+		for _, dep := range tpl.Services[name].Depends {
+			dep = strings.TrimSpace(dep)
+			if !hasService(tpl, dep) || dep == name {
+				continue
+			}
+			switch state[dep] {
+			case 0:
+				visit(dep)
+			case 1:
+				start := 0
+				for stack[start] != dep {
+					start++
+				}
+				cycle := rotateCycle(append([]string(nil), stack[start:]...))
+				key := strings.Join(cycle, ",")
+				if !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, append(cycle, cycle[0]))
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = 2
+	}
+
+	for _, name := range sortedServiceNames(tpl) {
+		if state[name] == 0 {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+// rotateCycle rotates a cycle so it starts at its smallest element, giving each cycle one spelling.
+func rotateCycle(cycle []string) []string {
+	first := 0
+	for i := range cycle {
+		if cycle[i] < cycle[first] {
+			first = i
+		}
+	}
+	return append(cycle[first:], cycle[:first]...)
+}
+
+func sortedServiceNames(tpl *repoTemplate) []string {
+	names := make([]string, 0, len(tpl.Services))
+	for name := range tpl.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hasService(tpl *repoTemplate, name string) bool {
+	_, ok := tpl.Services[name]
+	return ok
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// pathPrefix renders path as a message prefix, or nothing at the document root.
+func pathPrefix(path string) string {
+	if path == "" {
+		return ""
+	}
+	return path + ": "
+}
+
+// nodeAtPath follows mapping keys and sequence indexes from node, returning nil if any step is missing.
+func nodeAtPath(node *yaml.Node, path []string) *yaml.Node {
+	for _, step := range path {
+		if node == nil {
+			return nil
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			_, node = mappingEntry(node, step)
+		case yaml.SequenceNode:
+			idx, err := strconv.Atoi(step)
+			if err != nil || idx < 0 || idx >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[idx]
+		default:
+			return nil
+		}
+	}
+	return node
+}
+
+// listItem returns item i of a sequence node, following an alias such as `depends: *deps`, or
+// fallback when the list has no such item so problems are still reported at a nearby line.
+func listItem(list *yaml.Node, i int, fallback *yaml.Node) *yaml.Node {
+	if list != nil && list.Kind == yaml.AliasNode {
+		list = list.Alias
+	}
+	if list == nil || list.Kind != yaml.SequenceNode || i < 0 || i >= len(list.Content) {
+		return fallback
+	}
+	return list.Content[i]
+}
+
+// mappingEntry returns the key and value nodes for key in a mapping node, or nils. Keys brought
+// in by a `<<` merge key are found too.
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	content := mappingContent(node)
+	for i := 0; i+1 < len(content); i += 2 {
+		if content[i].Value == key {
+			return content[i], content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// mappingContent returns the alternating key and value nodes of a mapping, following an alias,
+// with each `<<` merge key replaced by the entries it merges in. As when decoding, the mapping's
+// own keys win over merged ones, and with `<<: [*a, *b]` the entries of a win over those of b.
+// Anything but a mapping has no entries.
+func mappingContent(node *yaml.Node) []*yaml.Node {
+	if node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var own, merged []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		if key.Tag != "!!merge" {
+			own = append(own, key, val)
+			continue
+		}
+		sources := []*yaml.Node{val}
+		if val.Kind == yaml.SequenceNode {
+			sources = val.Content
+		}
+		for _, source := range sources {
+			merged = append(merged, mappingContent(source)...)
+		}
+	}
+	if len(merged) == 0 {
+		return own
+	}
+
+	seen := make(map[string]bool, len(own)/2)
+	for i := 0; i < len(own); i += 2 {
+		seen[own[i].Value] = true
+	}
+	content := own
+	for i := 0; i+1 < len(merged); i += 2 {
+		if !seen[merged[i].Value] {
+			seen[merged[i].Value] = true
+			content = append(content, merged[i], merged[i+1])
+		}
+	}
+	return content
+}
+
+// yamlFields maps YAML keys to the struct fields they decode into.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// suggestField proposes the closest known key for a likely typo.
+func suggestField(key string, fields map[string]reflect.StructField) string {
+	best, bestDist := "", len(key)/2+1
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Bool:
+		return "true or false"
+	default:
+		return "a " + t.Kind().String()
+	}
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", node.Value)
+	}
+}
+
+// cleanDecodeError strips yaml.v3's "unmarshal errors" wrapping down to the first message.
+func cleanDecodeError(err error) string {
+	msg := err.Error()
+	if typeErr, ok := err.(*yaml.TypeError); ok && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+	}
+	msg = strings.TrimPrefix(msg, "yaml: ")
+	if _, rest, ok := strings.Cut(msg, ": "); ok && strings.HasPrefix(msg, "line ") {
+		msg = rest
+	}
+	return msg
+}
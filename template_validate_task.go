@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// TemplateValidateTask strictly checks the repository template and reports every problem it finds.
+type TemplateValidateTask struct {
+	TemplatePath string
+}
+
+func (t *TemplateValidateTask) ID() string {
+	return "validate"
+}
+
+func (t *TemplateValidateTask) Name() string {
+	return "Validate Template"
+}
+
+func (t *TemplateValidateTask) Description() string {
+	return "Check template.yml for typos, bad values and dependency problems"
+}
+
+func (t *TemplateValidateTask) Run(ctx context.Context) error {
+	path := t.TemplatePath
+	if path == "" {
+		path = defaultTemplatePath
+	}
+
+	layers, err := loadTemplateLayers(path, path == defaultTemplatePath)
+	var parseErr *templateParseError
+	switch {
+	case errors.As(err, &parseErr):
+		fmt.Println(parseErr)
+		return fmt.Errorf("template has 1 problem(s)")
+	case err != nil:
+		return err
+	}
+
+	issues := validateTemplate(layers)
+	if len(issues) == 0 {
+		fmt.Printf("template is valid (%d file(s) merged)\n", len(layers.Files))
+		return nil
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	return fmt.Errorf("template has %d problem(s)", len(issues))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// validateText validates a team template written inline and returns its issues as
+// "line:column: message".
+func validateText(t *testing.T, text string) []string {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "template.yml")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	layers, err := loadTemplateLayers(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issues []string
+	for _, issue := range validateTemplate(layers) {
+		issues = append(issues, fmt.Sprintf("%d:%d: %s", issue.Line, issue.Column, issue.Message))
+	}
+	return issues
+}
+
+func TestValidateTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "valid",
+			text: `
+services:
+  db:
+    clone: { repo: https://example.com/db.git }
+  api:
+    clone: git clone https://example.com/api.git
+    depends: [db]
+`,
+		},
+		{
+			name: "unknown field with a suggestion",
+			text: `
+services:
+  api:
+    clone: { repo: https://example.com/api.git }
+    postClonCmds: [make]
+`,
+			want: []string{`5:5: services.api: unknown field "postClonCmds" (did you mean "postCloneCmds"?)`},
+		},
+		{
+			name: "merge key",
+			text: `
+x-base: &base
+  clone: { repo: https://example.com/base.git }
+  branch: main
+services:
+  api:
+    <<: *base
+`,
+		},
+		{
+			name: "merge key with a list of aliases and own keys",
+			text: `
+x-clone: &clone
+  clone: { repo: https://example.com/api.git }
+  branch: main
+x-env: &env
+  environment: { APP_ENV: test }
+  branch: develop
+services:
+  db:
+    clone: { repo: https://example.com/db.git }
+  api:
+    <<: [*env, *clone]
+    depends: [db]
+`,
+		},
+		{
+			name: "problems inside a merged anchor are reported where they are written",
+			text: `
+x-base: &base
+  clone: { repo: https://example.com/base.git }
+  depnds: [db]
+services:
+  api:
+    <<: *base
+    bogus: true
+`,
+			want: []string{
+				`4:3: services.api: unknown field "depnds" (did you mean "depends"?)`,
+				`8:5: services.api: unknown field "bogus"`,
+			},
+		},
+		{
+			name: "dependency list written as an alias",
+			text: `
+x-deps: &deps [db, cache]
+services:
+  db:
+    clone: { repo: https://example.com/db.git }
+  api:
+    clone: { repo: https://example.com/api.git }
+    depends: *deps
+`,
+			want: []string{`2:20: services.api.depends: unknown service "cache"`},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := validateText(t, tc.text); !slices.Equal(got, tc.want) {
+				t.Errorf("issues:\n%q\nwant:\n%q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var varNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// expandVars replaces ${NAME}, ${port:NAME} and ${secret:NAME} references in value using lookup.
+// "$$" produces a literal "$"; any other "$", and shell expansions such as ${VAR:-default} or
+// ${#VAR} that are not template references, are left alone for the shell.
+func expandVars(value string, lookup func(name string) (string, error)) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c != '$' || i+1 == len(value) {
+			b.WriteByte(c)
+			continue
+		}
+
+		switch value[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(value[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", value)
+			}
+			ref := value[i+2 : i+2+end]
+			if !isTemplateRef(ref) {
+				// Shell syntax may nest, as in ${A:-${B}}; copy it through its matching brace.
+				closing := matchingBrace(value, i+1)
+				b.WriteString(value[i : closing+1])
+				i = closing
+				continue
+			}
+			resolved, err := lookup(ref)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(resolved)
+			i += 2 + end
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// matchingBrace returns the index of the "}" closing the "{" at open, or the last index of value
+// when it is never closed.
+func matchingBrace(value string, open int) int {
+	depth := 0
+	for i := open; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(value) - 1
+}
+
+// isTemplateRef reports whether the text between "${" and "}" is a reference the template resolves
+// rather than shell syntax.
+func isTemplateRef(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	return varNamePattern.MatchString(ref) || strings.HasPrefix(ref, portRefPrefix) || strings.HasPrefix(ref, secretRefPrefix)
+}
+
+// varScope resolves ${NAME} references for a single service. Environment keys resolve the way
+// mergedEnv would apply them (a non-empty value in your shell wins over the template unless the
+// service's envPolicy forces the key or isolates the service), then template vars, then the host
+// environment the service can see. Anything else is an error.
+//
+// ${port:NAME} references are handed to ports, which assigns the workspace's port for NAME, and
+// ${secret:NAME} references to secrets, which looks the secret up. Without those functions, as
+// when exporting or validating a template, the references are left as written.
+type varScope struct {
+	vars      map[string]string
+	env       map[string]string
+	policy    *envPolicy
+	ports     func(name string) (int, error)
+	secrets   func(name string) (string, error)
+	resolved  map[string]string
+	resolving map[string]bool
+}
+
+func newVarScope(vars, env map[string]string) *varScope {
+	return &varScope{
+		vars:      vars,
+		env:       env,
+		resolved:  map[string]string{},
+		resolving: map[string]bool{},
+	}
+}
+
+func (s *varScope) expand(value string) (string, error) {
+	return expandVars(value, s.lookup)
+}
+
+func (s *varScope) lookup(ref string) (string, error) {
+	name := strings.TrimSpace(ref)
+	if key, ok := strings.CutPrefix(name, portRefPrefix); ok {
+		return s.lookupPort(ref, strings.TrimSpace(key))
+	}
+	if key, ok := strings.CutPrefix(name, secretRefPrefix); ok {
+		return s.lookupSecret(ref, strings.TrimSpace(key))
+	}
+	if !varNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid variable reference ${%s}", ref)
+	}
+
+	if val, ok := s.resolved[name]; ok {
+		return val, nil
+	}
+	if s.resolving[name] {
+		return "", fmt.Errorf("variable ${%s} is defined in terms of itself", name)
+	}
+
+	if raw, ok := s.env[name]; ok {
+		if host, _ := s.policy.shellValue(name); host != "" && !s.policy.forced(name) {
+			return host, nil
+		}
+		return s.resolve(name, raw)
+	}
+	if raw, ok := s.vars[name]; ok {
+		return s.resolve(name, raw)
+	}
+	if host, ok := s.policy.shellValue(name); ok {
+		return host, nil
+	}
+	return "", fmt.Errorf("unresolved variable ${%s} (define it under vars or environment)", name)
+}
+
+func (s *varScope) lookupPort(ref, name string) (string, error) {
+	if !varNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid port reference ${%s}", ref)
+	}
+	if s.ports == nil {
+		return "${" + portRefPrefix + name + "}", nil
+	}
+	port, err := s.ports(name)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(port), nil
+}
+
+func (s *varScope) lookupSecret(ref, name string) (string, error) {
+	if !secretNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid secret reference ${%s}", ref)
+	}
+	if s.secrets == nil {
+		return "${" + secretRefPrefix + name + "}", nil
+	}
+	return s.secrets(name)
+}
+
+func (s *varScope) resolve(name, raw string) (string, error) {
+	s.resolving[name] = true
+	defer delete(s.resolving, name)
+
+	val, err := s.expand(raw)
+	if err != nil {
+		return "", err
+	}
+	s.resolved[name] = val
+	return val, nil
+}
+
+// serviceEnvironment returns the template defaults overlaid with the service's own environment.
+func (t *repoTemplate) serviceEnvironment(svc repoService) map[string]string {
+	if len(t.Defaults.Environment) == 0 && svc.Environment == nil {
+		return nil
+	}
+	env := make(map[string]string, len(t.Defaults.Environment)+len(svc.Environment))
+	for key, val := range t.Defaults.Environment {
+		env[key] = val
+	}
+	for key, val := range svc.Environment {
+		env[key] = val
+	}
+	return env
+}
+
+// interpolatedFields calls fn for every string of svc that supports ${VAR} interpolation, with
+// its YAML path relative to the service. fn may replace the value.
+func interpolatedFields(svc *repoService, fn func(path []string, value *string) error) error {
+	if err := cloneFields(&svc.Clone, fn); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{"branch", &svc.Branch},
+		{"tag", &svc.Tag},
+		{"commit", &svc.Commit},
+	} {
+		if err := fn([]string{field.key}, field.value); err != nil {
+			return err
+		}
+	}
+	for _, list := range []struct {
+		key    string
+		values []string
+	}{
+		{"postCloneCmds", svc.PostCloneCmds},
+		{"teardown", svc.Teardown},
+		{"start", svc.Start},
+		{"stop", svc.Stop},
+		{"status", svc.Status},
+		{"ports", svc.Ports},
+	} {
+		for i := range list.values {
+			if err := fn([]string{list.key, strconv.Itoa(i)}, &list.values[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := mapFields(svc.Environment, []string{"environment"}, fn); err != nil {
+		return err
+	}
+
+	if hc := svc.HealthCheck; hc != nil {
+		for _, field := range []struct {
+			key   string
+			value *string
+		}{
+			{"command", &hc.Command},
+			{"url", &hc.URL},
+			{"address", &hc.Address},
+			{"body", &hc.Body},
+		} {
+			if err := fn([]string{"healthCheck", field.key}, field.value); err != nil {
+				return err
+			}
+		}
+		if err := mapFields(hc.Headers, []string{"healthCheck", "headers"}, fn); err != nil {
+			return err
+		}
+	}
+
+	if e := svc.EnvFile; e != nil {
+		for _, field := range []struct {
+			key   string
+			value *string
+		}{
+			{"path", &e.Path},
+			{"example", &e.Example},
+		} {
+			if err := fn([]string{"envFile", field.key}, field.value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c := svc.Compose; c != nil {
+		if err := fn([]string{"compose", "project"}, &c.Project); err != nil {
+			return err
+		}
+		for _, list := range []struct {
+			key    string
+			values []string
+		}{
+			{"files", c.Files},
+			{"profiles", c.Profiles},
+		} {
+			for i := range list.values {
+				if err := fn([]string{"compose", list.key, strconv.Itoa(i)}, &list.values[i]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cloneFields calls fn for the interpolated strings of either form of a clone spec.
+func cloneFields(c *cloneSpec, fn func(path []string, value *string) error) error {
+	if c.Command != "" {
+		return fn([]string{"clone"}, &c.Command)
+	}
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{"repo", &c.Repo},
+		{"dir", &c.Dir},
+		{"filter", &c.Filter},
+	} {
+		if err := fn([]string{"clone", field.key}, field.value); err != nil {
+			return err
+		}
+	}
+	for i := range c.Sparse {
+		if err := fn([]string{"clone", "sparse", strconv.Itoa(i)}, &c.Sparse[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapFields applies fn to each value of m in key order, writing replacements back.
+func mapFields(m map[string]string, prefix []string, fn func(path []string, value *string) error) error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		val := m[key]
+		if err := fn(append(append([]string(nil), prefix...), key), &val); err != nil {
+			return err
+		}
+		m[key] = val
+	}
+	return nil
+}
+
+// render applies defaults and resolves ${VAR} references in every service, in place.
+// ${secret:NAME} references are left as written so listing, planning and status checks work
+// without any secret configured; withSecrets resolves them for a service about to run.
+func (t *repoTemplate) render() error {
+	if t.secrets != nil {
+		unrendered := *t
+		unrendered.Services = maps.Clone(t.Services)
+		t.unrendered = &unrendered
+		t.secrets = nil
+	}
+	for _, name := range sortedServiceNames(t) {
+		svc, err := t.renderService(name)
+		if err != nil {
+			return err
+		}
+		t.Services[name] = svc
+	}
+	t.Defaults = serviceDefaults{}
+	return nil
+}
+
+// withSecrets returns the named service with its ${secret:NAME} references looked up, for a
+// command, health check or .env file that needs their values.
+func (t *repoTemplate) withSecrets(name string) (repoService, error) {
+	if t.unrendered == nil {
+		return t.Services[name], nil
+	}
+	return t.unrendered.renderService(name)
+}
+
+// renderService returns a copy of the named service with defaults applied and variables resolved.
+func (t *repoTemplate) renderService(name string) (repoService, error) {
+	svc := cloneRepoService(t.Services[name])
+	if len(t.Defaults.Environment) > 0 {
+		svc.defaultEnvKeys = map[string]bool{}
+		for key := range t.Defaults.Environment {
+			if _, ok := svc.Environment[key]; !ok {
+				svc.defaultEnvKeys[key] = true
+			}
+		}
+	}
+	svc.Environment = t.serviceEnvironment(svc)
+	svc.EnvPolicy = t.Defaults.EnvPolicy.merge(svc.EnvPolicy)
+
+	scope := newVarScope(t.Vars, maps.Clone(svc.Environment))
+	scope.policy = svc.EnvPolicy
+	if t.ports != nil {
+		scope.ports = t.ports.port
+	}
+	scope.secrets = t.secrets
+	err := interpolatedFields(&svc, func(path []string, value *string) error {
+		expanded, err := scope.expand(*value)
+		if err != nil {
+			return fmt.Errorf("service %q: %s: %w", name, strings.Join(path, "."), err)
+		}
+		*value = expanded
+		return nil
+	})
+	return svc, err
+}
+
+// cloneRepoService deep-copies the fields of svc that rendering modifies.
+func cloneRepoService(svc repoService) repoService {
+	svc.Clone.Sparse = append([]string(nil), svc.Clone.Sparse...)
+	svc.PostCloneCmds = append([]string(nil), svc.PostCloneCmds...)
+	svc.Teardown = append([]string(nil), svc.Teardown...)
+	svc.Start = append([]string(nil), svc.Start...)
+	svc.Stop = append([]string(nil), svc.Stop...)
+	svc.Status = append([]string(nil), svc.Status...)
+	svc.Ports = append([]string(nil), svc.Ports...)
+	svc.Environment = maps.Clone(svc.Environment)
+	if svc.HealthCheck != nil {
+		hc := *svc.HealthCheck
+		hc.Headers = maps.Clone(hc.Headers)
+		svc.HealthCheck = &hc
+	}
+	if svc.EnvFile != nil {
+		e := *svc.EnvFile
+		svc.EnvFile = &e
+	}
+	if svc.Compose != nil {
+		c := *svc.Compose
+		c.Files = append([]string(nil), c.Files...)
+		c.Profiles = append([]string(nil), c.Profiles...)
+		svc.Compose = &c
+	}
+	return svc
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	lookup := func(ref string) (string, error) {
+		switch name := strings.TrimSpace(ref); name {
+		case "HOST":
+			return "localhost", nil
+		case "port:API":
+			return "20001", nil
+		case "secret:api/token":
+			return "s3cret", nil
+		default:
+			return "", fmt.Errorf("unresolved variable ${%s}", name)
+		}
+	}
+
+	for _, tc := range []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"no references", "no references", ""},
+		{"http://${HOST}:${port:API}/", "http://localhost:20001/", ""},
+		{"${ HOST }", "localhost", ""},
+		{"Bearer ${secret:api/token}", "Bearer s3cret", ""},
+		{"$${HOST} costs $$5", "${HOST} costs $5", ""},
+		{"$HOST and $1 stay", "$HOST and $1 stay", ""},
+		{"trailing $", "trailing $", ""},
+		{"${HOST:-fallback}", "${HOST:-fallback}", ""},
+		{"${#HOST} ${HOST/a/b} ${HOST%%.*}", "${#HOST} ${HOST/a/b} ${HOST%%.*}", ""},
+		{"${A:-${HOST}} then ${HOST}", "${A:-${HOST}} then localhost", ""},
+		{"${MISSING}", "", "unresolved variable ${MISSING}"},
+		{"${HOST", "", "unterminated ${"},
+	} {
+		got, err := expandVars(tc.value, lookup)
+		switch {
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("expandVars(%q) error = %v, want %q", tc.value, err, tc.wantErr)
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("expandVars(%q) failed: %v", tc.value, err)
+		case got != tc.want:
+			t.Errorf("expandVars(%q) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestIsTemplateRef(t *testing.T) {
+	for ref, want := range map[string]bool{
+		"HOST":         true,
+		" HOST ":       true,
+		"_private1":    true,
+		"port:API":     true,
+		"secret:a/b":   true,
+		"port:":        true,
+		"HOST:-x":      false,
+		"#HOST":        false,
+		"HOST/a/b":     false,
+		"1HOST":        false,
+		"":             false,
+		"HOST%%.*":     false,
+		"portal:thing": false,
+	} {
+		if got := isTemplateRef(ref); got != want {
+			t.Errorf("isTemplateRef(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	defaultTemplatePath = "template.yml"
+	defaultRepoDir      = "dev-app"
+)
+
+// workspaceConfig locates the template and the directory services are cloned into. It is
+// embedded by every task that works on the cloned workspace.
+type workspaceConfig struct {
+	TemplatePath string
+	TargetDir    string
+}
+
+// loadTemplate reads the configured template and computes the dependency-safe clone order.
+func (w *workspaceConfig) loadTemplate() (*repoTemplate, []string, error) {
+	templatePath := w.templatePath()
+	template, err := decodeRepoTemplate(templatePath, templatePath == defaultTemplatePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.bindTemplate(template, "")
+	if err := template.render(); err != nil {
+		return nil, nil, err
+	}
+
+	order, err := template.cloneOrder()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return template, order, nil
+}
+
+// bindTemplate prepares template for rendering in this workspace: ${port:NAME} references are
+// assigned ports for scope (see portAllocator) and ${secret:NAME} references are looked up
+// through the template's secret providers.
+func (w *workspaceConfig) bindTemplate(template *repoTemplate, scope string) {
+	template.ports = w.portAllocator(template, scope)
+	template.secrets = newSecretResolver(template.Secrets).resolve
+}
+
+// portAllocator assigns ${port:NAME} references from the template's port range, skipping ports
+// already in use and ports the run journal has recorded. New assignments are only held in memory
+// until save records them, so plans and read-only commands never write to the workspace. A
+// non-empty scope keeps separate ports for a copy of the workspace such as a worktree.
+type portAllocator struct {
+	targetDir string
+	template  *repoTemplate
+	scope     string
+
+	once  sync.Once
+	state *workspaceState
+	err   error
+}
+
+func (w *workspaceConfig) portAllocator(template *repoTemplate, scope string) *portAllocator {
+	return &portAllocator{targetDir: w.targetDir(), template: template, scope: scope}
+}
+
+func (a *portAllocator) port(name string) (int, error) {
+	low, high, err := a.template.portRange()
+	if err != nil {
+		return 0, err
+	}
+	a.once.Do(func() {
+		a.state, a.err = loadWorkspaceState(a.targetDir)
+	})
+	if a.err != nil {
+		return 0, a.err
+	}
+	if a.scope != "" {
+		name += worktreeSeparator + a.scope
+	}
+	return a.state.port(name, low, high, func(port int) bool { return !portInUse(port) })
+}
+
+// save records the ports assigned so far in state so every later command sees the same ports.
+// Commands that provision or start services call it; nothing else persists an assignment.
+func (a *portAllocator) save(state *workspaceState) error {
+	if a == nil || a.state == nil {
+		return nil
+	}
+	return state.recordPorts(a.state.portAssignments())
+}
+
+// savePorts records the ports assigned while rendering template in the workspace's run journal.
+func (w *workspaceConfig) savePorts(template *repoTemplate) error {
+	if template.ports == nil || template.ports.state == nil {
+		return nil
+	}
+	state, err := loadWorkspaceState(w.targetDir())
+	if err != nil {
+		return err
+	}
+	return template.ports.save(state)
+}
+
+// templatePath returns the configured template path or the default.
+func (w *workspaceConfig) templatePath() string {
+	if w.TemplatePath != "" {
+		return w.TemplatePath
+	}
+	return defaultTemplatePath
+}
+
+// targetDir returns the directory that repositories should be cloned into.
+func (w *workspaceConfig) targetDir() string {
+	if w.TargetDir != "" {
+		return w.TargetDir
+	}
+	return defaultRepoDir
+}
+
+// clonedServicePath is servicePath for a service that must already be cloned.
+func (w *workspaceConfig) clonedServicePath(template *repoTemplate, name string) (string, error) {
+	repoPath, err := w.servicePath(template, name)
+	if err != nil {
+		return "", err
+	}
+	exists, err := pathExists(repoPath)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("service %q: unable to inspect %s: %w", name, repoPath, err)
+	case !exists:
+		return "", fmt.Errorf("service %q is not cloned at %s; clone it first", name, repoPath)
+	}
+	return repoPath, nil
+}
+
+// servicePath returns where the named service is (or would be) cloned.
+func (w *workspaceConfig) servicePath(template *repoTemplate, name string) (string, error) {
+	clone, err := parseCloneCommand(name, template.Services[name].Clone)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(w.targetDir(), clone.Dir), nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	workspaceLogsDir = "logs"
+	combinedLogFile  = "combined.log"
+	// maxRunLogs is how many runs are kept; older ones are removed when a new run starts.
+	maxRunLogs = 20
+	// runLogTimeFormat names run directories so they sort in the order they were started.
+	runLogTimeFormat = "20060102-150405"
+)
+
+var logNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// runLog keeps the output of one run under <workspace>/.devtools/logs/<time>-<command>/:
+// combined.log holds every line as it was printed and <service>.log the lines of each service.
+// Lines are timestamped and secret values redacted. Writes are serialised by syncOutput.
+type runLog struct {
+	dir      string
+	combined *os.File
+	services map[string]*os.File
+	// err is the first write error; logging stops after it so the run itself is unaffected.
+	err error
+}
+
+// runLogsDir returns where the run logs of the workspace at targetDir are kept.
+func runLogsDir(targetDir string) string {
+	return filepath.Join(targetDir, workspaceMetaDir, workspaceLogsDir)
+}
+
+// startRunLog creates the log directory for a new run of command, removing the oldest runs
+// beyond maxRunLogs.
+func startRunLog(targetDir, command string) (*runLog, error) {
+	root := runLogsDir(targetDir)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("create run log directory: %w", err)
+	}
+	if err := pruneRunLogs(root, maxRunLogs-1); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	base := started.Format(runLogTimeFormat) + "-" + logNameUnsafe.ReplaceAllString(command, "-")
+	dir := filepath.Join(root, base)
+	for i := 2; ; i++ {
+		err := os.Mkdir(dir, 0o755)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("create run log directory: %w", err)
+		}
+		dir = filepath.Join(root, fmt.Sprintf("%s-%d", base, i))
+	}
+
+	combined, err := os.Create(filepath.Join(dir, combinedLogFile))
+	if err != nil {
+		return nil, fmt.Errorf("create run log: %w", err)
+	}
+	l := &runLog{dir: dir, combined: combined, services: map[string]*os.File{}}
+	l.writeTo(combined, []byte(fmt.Sprintf("devtools %s started %s\n", command, started.Format(time.RFC1123))))
+	return l, nil
+}
+
+// pruneRunLogs removes the oldest run directories in root until at most keep remain.
+func pruneRunLogs(root string, keep int) error {
+	runs, err := listRunLogs(root)
+	if err != nil {
+		return err
+	}
+	for len(runs) > keep {
+		oldest := runs[len(runs)-1]
+		if err := os.RemoveAll(filepath.Join(root, oldest)); err != nil {
+			return fmt.Errorf("remove old run log %s: %w", oldest, err)
+		}
+		runs = runs[:len(runs)-1]
+	}
+	return nil
+}
+
+// listRunLogs returns the run directories in root, newest first.
+func listRunLogs(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read run logs: %w", err)
+	}
+	var runs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runs = append(runs, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+	return runs, nil
+}
+
+// write records line in the combined log and, when service is set, in that service's log.
+func (l *runLog) write(service string, tagged, line []byte) {
+	if l == nil || l.err != nil {
+		return
+	}
+	l.writeTo(l.combined, tagged)
+	if service == "" {
+		return
+	}
+
+	f, ok := l.services[service]
+	if !ok {
+		var err error
+		f, err = os.Create(filepath.Join(l.dir, logNameUnsafe.ReplaceAllString(service, "-")+".log"))
+		if err != nil {
+			l.err = err
+			return
+		}
+		l.services[service] = f
+	}
+	l.writeTo(f, line)
+}
+
+func (l *runLog) writeTo(f *os.File, line []byte) {
+	if l.err != nil {
+		return
+	}
+	stamped := time.Now().Format("15:04:05.000") + " " + redactSecrets(string(line))
+	if _, err := io.WriteString(f, stamped); err != nil {
+		l.err = err
+	}
+}
+
+// close records how the run ended and closes every log file.
+func (l *runLog) close(runErr error) error {
+	if l == nil {
+		return nil
+	}
+	outcome := "finished ok\n"
+	if runErr != nil {
+		outcome = "failed: " + strings.ReplaceAll(runErr.Error(), "\n", "; ") + "\n"
+	}
+	l.writeTo(l.combined, []byte(outcome))
+
+	errs := []error{l.err, l.combined.Close()}
+	for _, f := range l.services {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newRunOutput is newSyncOutput for a run of command whose output is also kept in a run log in
+// the workspace at targetDir. If the log cannot be written a warning is printed and the run goes
+// ahead without it. The returned function records how the run ended and closes the log.
+func newRunOutput(w io.Writer, targetDir, command string) (*syncOutput, func(err error)) {
+	out := newSyncOutput(w)
+	if exists, _ := pathExists(targetDir); !exists {
+		// Nothing has been cloned, so there is nothing to run and no workspace to log into.
+		return out, func(error) {}
+	}
+	l, err := startRunLog(targetDir, command)
+	if err != nil {
+		out.printf("warning: output of this run is not logged: %v\n", err)
+		return out, func(error) {}
+	}
+	out.log = l
+	return out, func(runErr error) {
+		if err := l.close(runErr); err != nil {
+			fmt.Fprintf(w, "warning: run log %s is incomplete: %v\n", l.dir, err)
+		}
+	}
+}
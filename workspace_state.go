@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	workspaceMetaDir   = ".devtools"
+	workspaceStateFile = "state.json"
+)
+
+// workspaceState is the run journal kept at <workspace>/.devtools/state.json. It records which
+// provisioning steps have succeeded so an interrupted or failed run can resume where it stopped.
+type workspaceState struct {
+	mu   sync.Mutex
+	path string
+
+	Services map[string]*serviceState `json:"services"`
+	// Ports records the port assigned to each ${port:NAME} reference.
+	Ports map[string]int `json:"ports,omitempty"`
+	// EnvFiles records, per service, the values last written to its generated .env file so
+	// values changed by hand can be told apart from values the template changed. Secret values
+	// are recorded as their secretDigest.
+	EnvFiles map[string]map[string]string `json:"envFiles,omitempty"`
+}
+
+// serviceState tracks the provisioning progress of a single service.
+type serviceState struct {
+	Cloned    bool      `json:"cloned"`
+	PostClone []string  `json:"postClone,omitempty"`
+	Healthy   bool      `json:"healthy"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// loadWorkspaceState reads the journal for targetDir, returning an empty one if none exists yet.
+func loadWorkspaceState(targetDir string) (*workspaceState, error) {
+	state := &workspaceState{
+		path:     filepath.Join(targetDir, workspaceMetaDir, workspaceStateFile),
+		Services: map[string]*serviceState{},
+	}
+
+	contents, err := os.ReadFile(state.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read workspace state: %w", err)
+	}
+
+	if err := json.Unmarshal(contents, state); err != nil {
+		return nil, fmt.Errorf("parse workspace state %s: %w", state.path, err)
+	}
+	if state.Services == nil {
+		state.Services = map[string]*serviceState{}
+	}
+	return state, nil
+}
+
+// service returns a copy of the recorded progress for name and whether any was recorded.
+func (s *workspaceState) service(name string) (serviceState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.Services[name]
+	if !ok {
+		return serviceState{}, false
+	}
+	copied := *entry
+	copied.PostClone = append([]string(nil), entry.PostClone...)
+	return copied, true
+}
+
+// update applies fn to the entry for name and persists the journal.
+func (s *workspaceState) update(name string, fn func(*serviceState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.Services[name]
+	if !ok {
+		entry = &serviceState{}
+		s.Services[name] = entry
+	}
+	fn(entry)
+	entry.UpdatedAt = time.Now().UTC()
+
+	return s.saveLocked()
+}
+
+// port returns the port recorded for name, or assigns the first port in [low, high] that free
+// accepts and no other name holds. A new assignment is kept in memory; recordPorts persists it.
+func (s *workspaceState) port(name string, low, high int, free func(port int) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if port, ok := s.Ports[name]; ok {
+		return port, nil
+	}
+
+	taken := make(map[int]bool, len(s.Ports))
+	for _, port := range s.Ports {
+		taken[port] = true
+	}
+	for port := low; port <= high; port++ {
+		if taken[port] || !free(port) {
+			continue
+		}
+		if s.Ports == nil {
+			s.Ports = map[string]int{}
+		}
+		s.Ports[name] = port
+		return port, nil
+	}
+	return 0, fmt.Errorf("no free port left in %d-%d for ${port:%s}", low, high, name)
+}
+
+// portAssignments returns a copy of the recorded ports.
+func (s *workspaceState) portAssignments() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.Ports)
+}
+
+// recordPorts adds the assignments in ports that the journal does not hold yet, keeping any port
+// already recorded for a name, and persists the journal if anything was added.
+func (s *workspaceState) recordPorts(ports map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := false
+	for name, port := range ports {
+		if _, ok := s.Ports[name]; ok {
+			continue
+		}
+		if s.Ports == nil {
+			s.Ports = map[string]int{}
+		}
+		s.Ports[name] = port
+		added = true
+	}
+	if !added {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// envFile returns a copy of the values last written to name's .env file.
+func (s *workspaceState) envFile(name string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.EnvFiles[name])
+}
+
+// recordEnvFile stores the values written to name's .env file and persists the journal.
+func (s *workspaceState) recordEnvFile(name string, values map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.EnvFiles == nil {
+		s.EnvFiles = map[string]map[string]string{}
+	}
+	s.EnvFiles[name] = maps.Clone(values)
+	return s.saveLocked()
+}
+
+// releasePorts forgets the ports assigned to names ending in suffix, such as the ports of a
+// removed worktree, and persists the journal if any were recorded.
+func (s *workspaceState) releasePorts(suffix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	released := false
+	for name := range s.Ports {
+		if strings.HasSuffix(name, suffix) {
+			delete(s.Ports, name)
+			released = true
+		}
+	}
+	if !released {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// reset clears the recorded progress for name so the next run repeats its post-clone commands
+// and health check. Services whose clone no longer exists are forgotten entirely.
+func (s *workspaceState) reset(name string, cloned bool) error {
+	if !cloned {
+		return s.forget(name)
+	}
+	return s.update(name, func(entry *serviceState) {
+		*entry = serviceState{Cloned: true}
+	})
+}
+
+// forget drops the entry and .env record for name and persists the journal.
+func (s *workspaceState) forget(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.Services, name)
+	delete(s.EnvFiles, name)
+	return s.saveLocked()
+}
+
+func (s *workspaceState) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("create workspace state directory: %w", err)
+	}
+
+	contents, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode workspace state: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(contents, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write workspace state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("write workspace state: %w", err)
+	}
+	return nil
+}
+
+// resumeIndex returns how many of commands already completed, in order, during earlier runs.
+// Editing a command in the template invalidates it and everything after it. Commands are
+// recorded as the template writes them, with ${secret:NAME} references unresolved, so a changed
+// secret does not repeat a step.
+func (st serviceState) resumeIndex(commands []string) int {
+	done := 0
+	for done < len(commands) && done < len(st.PostClone) && commands[done] == st.PostClone[done] {
+		done++
+	}
+	return done
+}
+
+// provisioned reports whether every step for svc has completed.
+func (st serviceState) provisioned(svc repoService) bool {
+	steps := postCloneSteps(svc.PostCloneCmds)
+	if st.resumeIndex(steps) < len(steps) {
+		return false
+	}
+	return svc.HealthCheck == nil || st.Healthy
+}
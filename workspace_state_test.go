@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestResumeIndex(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		recorded []string
+		commands []string
+		want     int
+	}{
+		{"nothing recorded", nil, []string{"a", "b"}, 0},
+		{"no commands", []string{"a"}, nil, 0},
+		{"all done", []string{"a", "b"}, []string{"a", "b"}, 2},
+		{"partly done", []string{"a"}, []string{"a", "b", "c"}, 1},
+		{"edited command reruns it and the rest", []string{"a", "b", "c"}, []string{"a", "B", "c"}, 1},
+		{"removed command", []string{"a", "b", "c"}, []string{"a", "c"}, 1},
+		{"appended command", []string{"a", "b"}, []string{"a", "b", "c"}, 2},
+		{"secrets compare unresolved", []string{"login ${secret:api/token}"}, []string{"login ${secret:api/token}"}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			st := serviceState{Cloned: true, PostClone: tc.recorded}
+			if got := st.resumeIndex(tc.commands); got != tc.want {
+				t.Errorf("resumeIndex = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProvisioned(t *testing.T) {
+	health := &serviceHealth{}
+	for _, tc := range []struct {
+		name  string
+		state serviceState
+		svc   repoService
+		want  bool
+	}{
+		{"nothing to run", serviceState{Cloned: true}, repoService{}, true},
+		{"blank commands are skipped", serviceState{Cloned: true, PostClone: []string{"make"}}, repoService{PostCloneCmds: []string{" ", "make", ""}}, true},
+		{"commands pending", serviceState{Cloned: true, PostClone: []string{"make"}}, repoService{PostCloneCmds: []string{"make", "make test"}}, false},
+		{"health check pending", serviceState{Cloned: true}, repoService{HealthCheck: health}, false},
+		{"health check passed", serviceState{Cloned: true, Healthy: true}, repoService{HealthCheck: health}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.state.provisioned(tc.svc); got != tc.want {
+				t.Errorf("provisioned = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
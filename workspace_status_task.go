@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WorkspaceStatusTask shows the git state of every cloned service in one table.
+type WorkspaceStatusTask struct {
+	workspaceConfig
+}
+
+// serviceStatus is one row of the workspace status report.
+type serviceStatus struct {
+	Service    string     `json:"service"`
+	Path       string     `json:"path"`
+	Missing    bool       `json:"missing"`
+	Branch     string     `json:"branch,omitempty"`
+	Detached   bool       `json:"detached,omitempty"`
+	Upstream   string     `json:"upstream,omitempty"`
+	Ahead      int        `json:"ahead"`
+	Behind     int        `json:"behind"`
+	Changed    int        `json:"uncommitted"`
+	Untracked  int        `json:"untracked"`
+	LastCommit *time.Time `json:"lastCommit,omitempty"`
+	Sparse     []string   `json:"sparse,omitempty"`
+	Filter     string     `json:"filter,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func (t *WorkspaceStatusTask) ID() string {
+	return "status"
+}
+
+func (t *WorkspaceStatusTask) Name() string {
+	return "Workspace Status"
+}
+
+func (t *WorkspaceStatusTask) Description() string {
+	return "Show branch, sync and local change state for every cloned service"
+}
+
+func (t *WorkspaceStatusTask) Run(ctx context.Context) error {
+	statuses, err := t.collect(ctx, false)
+	if err != nil {
+		return err
+	}
+	printWorkspaceStatus(os.Stdout, statuses, time.Now())
+	return nil
+}
+
+func (t *WorkspaceStatusTask) RunArgs(ctx context.Context, args []string) error {
+	fs := newCommandFlags(t.ID(), t.Description())
+	asJSON := fs.Bool("json", false, "print the status as JSON")
+	fetch := fs.Bool("fetch", false, "fetch each clone first so ahead/behind counts are current")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	statuses, err := t.collect(ctx, *fetch)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+	printWorkspaceStatus(os.Stdout, statuses, time.Now())
+	return nil
+}
+
+// collect inspects every service in the template in clone order. Problems with a single clone are
+// recorded on its row rather than aborting the report.
+func (t *WorkspaceStatusTask) collect(ctx context.Context, fetch bool) ([]serviceStatus, error) {
+	template, order, err := t.loadTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]serviceStatus, 0, len(order))
+	for _, name := range order {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, t.inspect(ctx, template, name, fetch))
+	}
+	return statuses, nil
+}
+
+func (t *WorkspaceStatusTask) inspect(ctx context.Context, template *repoTemplate, name string, fetch bool) serviceStatus {
+	status := serviceStatus{Service: name}
+
+	repoPath, err := t.servicePath(template, name)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Path = repoPath
+
+	exists, err := pathExists(repoPath)
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+		return status
+	case !exists:
+		status.Missing = true
+		return status
+	}
+
+	if fetch {
+		if _, err := gitOutput(ctx, repoPath, "fetch", "--prune"); err != nil {
+			status.Error = err.Error()
+		}
+	}
+
+	repo, err := inspectRepo(ctx, repoPath)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Branch = repo.Branch
+	status.Detached = repo.Detached
+	status.Upstream = repo.Upstream
+	status.Ahead = repo.Ahead
+	status.Behind = repo.Behind
+	status.Changed = repo.Changed
+	status.Untracked = repo.Untracked
+	status.Sparse = repo.Sparse
+	status.Filter = repo.Filter
+	if !repo.LastCommit.IsZero() {
+		last := repo.LastCommit
+		status.LastCommit = &last
+	}
+	return status
+}
+
+func printWorkspaceStatus(w io.Writer, statuses []serviceStatus, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tBRANCH\tUPSTREAM\tAHEAD/BEHIND\tUNCOMMITTED\tUNTRACKED\tLAST COMMIT\tCHECKOUT")
+	for _, st := range statuses {
+		switch {
+		case st.Missing:
+			fmt.Fprintf(tw, "%s\t(missing: %s)\n", st.Service, st.Path)
+			continue
+		case st.Error != "" && st.Branch == "" && !st.Detached:
+			fmt.Fprintf(tw, "%s\t(error: %s)\n", st.Service, st.Error)
+			continue
+		}
+
+		branch := st.Branch
+		if st.Detached {
+			branch = "(detached)"
+		}
+
+		upstream, sync := "-", "-"
+		if st.Upstream != "" {
+			upstream = st.Upstream
+			sync = fmt.Sprintf("+%d/-%d", st.Ahead, st.Behind)
+		}
+
+		age := "-"
+		if st.LastCommit != nil {
+			age = formatAge(now.Sub(*st.LastCommit))
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", st.Service, branch, upstream, sync, st.Changed, st.Untracked, age, st.checkout())
+	}
+	tw.Flush()
+
+	for _, st := range statuses {
+		if st.Error != "" && (st.Branch != "" || st.Detached) {
+			fmt.Fprintf(w, "warning: %s: %s\n", st.Service, st.Error)
+		}
+	}
+}
+
+// checkout describes how much of the repository the clone holds, e.g. "sparse (2 dirs), partial".
+func (st serviceStatus) checkout() string {
+	var parts []string
+	if st.Sparse != nil {
+		parts = append(parts, fmt.Sprintf("sparse (%d dirs)", len(st.Sparse)))
+	}
+	if st.Filter != "" {
+		parts = append(parts, "partial "+st.Filter)
+	}
+	if len(parts) == 0 {
+		return "full"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatAge renders a duration the way people talk about commit ages, e.g. "3h ago".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// worktreeSeparator joins a service's clone directory and branch into the worktree directory
+// name, e.g. core-api@feature-login.
+const worktreeSeparator = "@"
+
+var branchSlugUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WorktreeTask manages extra git worktrees of cloned services so a second branch can be checked
+// out, and run, next to the main clone.
+type WorktreeTask struct {
+	workspaceConfig
+}
+
+// serviceWorktree is an extra worktree of a service's clone.
+type serviceWorktree struct {
+	Service string
+	Path    string
+	Branch  string
+	Head    string
+}
+
+func (t *WorktreeTask) ID() string {
+	return "worktree"
+}
+
+func (t *WorktreeTask) Name() string {
+	return "Service Worktrees"
+}
+
+func (t *WorktreeTask) Description() string {
+	return "Check out another branch of a cloned service alongside the main clone"
+}
+
+func (t *WorktreeTask) Run(ctx context.Context) error {
+	template, order, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Println("\n=== Service Worktrees ===")
+		if err := t.list(ctx, os.Stdout, template, order); err != nil {
+			return err
+		}
+
+		fmt.Println("\n1. Create a worktree")
+		fmt.Println("2. Create a worktree and provision it with a port offset")
+		fmt.Println("3. Remove a worktree")
+		fmt.Println("4. Back to main menu")
+		fmt.Print("\nSelect option: ")
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return fmt.Errorf("failed to read input: %w", err)
+			}
+			return errors.New("input stream closed")
+		}
+
+		choice := strings.TrimSpace(scanner.Text())
+		if choice == "4" {
+			return nil
+		}
+		if choice != "1" && choice != "2" && choice != "3" {
+			fmt.Println("Invalid option. Please try again.")
+			continue
+		}
+
+		name, ok := promptService(scanner, order, "Service")
+		if !ok {
+			continue
+		}
+		branch, ok := promptLine(scanner, "Branch")
+		if !ok {
+			continue
+		}
+
+		switch choice {
+		case "1":
+			err = t.add(ctx, template, name, branch, false, 0)
+		case "2":
+			offsetText, ok := promptLine(scanner, "Port offset (e.g. 100)")
+			if !ok {
+				continue
+			}
+			offset, convErr := strconv.Atoi(offsetText)
+			if convErr != nil {
+				fmt.Println("Please enter a whole number.")
+				continue
+			}
+			err = t.add(ctx, template, name, branch, true, offset)
+		case "3":
+			err = t.remove(ctx, template, name, branch, false)
+		}
+		if err != nil {
+			fmt.Printf("Error: %s\n", redactSecrets(err.Error()))
+		}
+	}
+}
+
+// Subcommands exposes worktree management to the CLI.
+func (t *WorktreeTask) Subcommands() []Subcommand {
+	return []Subcommand{
+		{
+			Name:    "add",
+			Summary: "Create a worktree of a service on another branch",
+			Run:     t.runAdd,
+		},
+		{
+			Name:    "list",
+			Summary: "List the extra worktrees of every cloned service",
+			Run:     t.runList,
+		},
+		{
+			Name:    "remove",
+			Summary: "Remove a service worktree",
+			Run:     t.runRemove,
+		},
+	}
+}
+
+func (t *WorktreeTask) runAdd(ctx context.Context, args []string) error {
+	fs := newCommandFlags("worktree add", "Create a worktree of a cloned service at <workspace>/<dir>@<branch>, optionally running the service's post-clone commands in it with every *PORT environment value shifted by an offset.")
+	service := fs.String("service", "", "service to create the worktree for (required)")
+	branch := fs.String("branch", "", "branch to check out; created from the current HEAD if it does not exist (required)")
+	provision := fs.Bool("provision", false, "run the service's post-clone commands and health check in the new worktree")
+	portOffset := fs.Int("port-offset", 0, "add this to every numeric *PORT environment value when provisioning")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	if *service == "" || *branch == "" {
+		return usagef("worktree add: --service and --branch are required")
+	}
+	if *portOffset != 0 && !*provision {
+		return usagef("worktree add: --port-offset only applies with --provision")
+	}
+
+	template, _, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+	if _, ok := template.Services[*service]; !ok {
+		return usagef("worktree add: unknown service %q", *service)
+	}
+	return t.add(ctx, template, *service, *branch, *provision, *portOffset)
+}
+
+func (t *WorktreeTask) runList(ctx context.Context, args []string) error {
+	fs := newCommandFlags("worktree list", "List the extra worktrees of every cloned service.")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	template, order, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+	return t.list(ctx, os.Stdout, template, order)
+}
+
+func (t *WorktreeTask) runRemove(ctx context.Context, args []string) error {
+	fs := newCommandFlags("worktree remove", "Remove a service worktree. The branch itself is kept.")
+	service := fs.String("service", "", "service the worktree belongs to (required)")
+	branch := fs.String("branch", "", "branch the worktree was created for (required)")
+	force := fs.Bool("force", false, "remove the worktree even if it has uncommitted changes")
+	if err := parseCommandFlags(fs, args); err != nil {
+		return err
+	}
+	if *service == "" || *branch == "" {
+		return usagef("worktree remove: --service and --branch are required")
+	}
+
+	template, _, err := t.loadTemplate()
+	if err != nil {
+		return err
+	}
+	if _, ok := template.Services[*service]; !ok {
+		return usagef("worktree remove: unknown service %q", *service)
+	}
+	return t.remove(ctx, template, *service, *branch, *force)
+}
+
+// add creates the worktree for branch next to the service's clone and optionally provisions it.
+func (t *WorktreeTask) add(ctx context.Context, template *repoTemplate, name, branch string, provision bool, portOffset int) error {
+	repoPath, err := t.clonedServicePath(template, name)
+	if err != nil {
+		return err
+	}
+	// git resolves worktree paths relative to the clone, so they must be absolute.
+	if repoPath, err = filepath.Abs(repoPath); err != nil {
+		return err
+	}
+	path, err := newWorktreePath(ctx, name, repoPath, branch)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"worktree", "add", path, branch}
+	if _, err := gitOutput(ctx, repoPath, "rev-parse", "--verify", "--quiet", branch+"^{commit}"); err != nil {
+		if _, err := gitOutput(ctx, repoPath, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+branch); err != nil {
+			fmt.Printf("Branch %s does not exist yet; creating it from the current HEAD of %s\n", branch, repoPath)
+			args = []string{"worktree", "add", "-b", branch, path}
+		}
+	}
+	if _, err := gitOutput(ctx, repoPath, args...); err != nil {
+		return fmt.Errorf("service %q: %w", name, err)
+	}
+	fmt.Printf("Created worktree for %s on %s at %s\n", name, branch, path)
+
+	if !provision {
+		return nil
+	}
+	return t.provision(ctx, name, path, portOffset)
+}
+
+// provision runs the service's post-clone commands and health check inside a worktree. The
+// template is rendered again with the port offset applied so ${VAR} references such as a
+// health check URL follow the shifted ports, and ${port:NAME} references are assigned ports of
+// the worktree's own. Provisioning progress is not recorded in the run journal.
+func (t *WorktreeTask) provision(ctx context.Context, name, path string, portOffset int) error {
+	templatePath := t.templatePath()
+	template, err := decodeRepoTemplate(templatePath, templatePath == defaultTemplatePath)
+	if err != nil {
+		return err
+	}
+	t.bindTemplate(template, filepath.Base(path))
+	shifted, err := template.offsetPorts(name, portOffset)
+	if err != nil {
+		return err
+	}
+	svc, err := template.renderService(name)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range shifted {
+		fmt.Printf("%s=%s (offset %+d)\n", key, svc.Environment[key], portOffset)
+		if port, err := parsePort(svc.Environment[key]); err == nil && portInUse(port) {
+			return fmt.Errorf("service %q: %s=%d is already in use; choose a different --port-offset", name, key, port)
+		}
+	}
+	if err := t.savePorts(template); err != nil {
+		return err
+	}
+
+	out := newServiceWriter(newSyncOutput(os.Stdout), filepath.Base(path))
+	defer out.Flush()
+
+	if svc.EnvFile != nil {
+		if err := writeServiceEnvFile(out, nil, path, name, svc, false); err != nil {
+			return err
+		}
+	}
+	if err := runPostCloneCommands(ctx, out, path, name, svc.PostCloneCmds, svc.env(), nil); err != nil {
+		return err
+	}
+	if svc.HealthCheck != nil {
+		return runHealthCheck(ctx, out, path, name, svc.HealthCheck, svc.env())
+	}
+	return nil
+}
+
+// remove deletes the worktree for branch; git refuses if it has uncommitted changes unless force is set.
+func (t *WorktreeTask) remove(ctx context.Context, template *repoTemplate, name, branch string, force bool) error {
+	repoPath, err := t.clonedServicePath(template, name)
+	if err != nil {
+		return err
+	}
+	worktrees, err := listWorktrees(ctx, name, repoPath)
+	if err != nil {
+		return err
+	}
+	var path string
+	for _, wt := range worktrees {
+		if wt.Branch == branch {
+			path = wt.Path
+			break
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("service %q has no worktree for branch %s", name, branch)
+	}
+
+	args := []string{"worktree", "remove", path}
+	if force {
+		args = append(args, "--force")
+	}
+	if _, err := gitOutput(ctx, repoPath, args...); err != nil {
+		return fmt.Errorf("service %q: %w", name, err)
+	}
+	if _, err := gitOutput(ctx, repoPath, "worktree", "prune"); err != nil {
+		return fmt.Errorf("service %q: %w", name, err)
+	}
+	fmt.Printf("Removed worktree %s (branch %s was kept)\n", path, branch)
+
+	state, err := loadWorkspaceState(t.targetDir())
+	if err != nil {
+		return err
+	}
+	return state.releasePorts(worktreeSeparator + filepath.Base(path))
+}
+
+// list prints every extra worktree of the cloned services.
+func (t *WorktreeTask) list(ctx context.Context, w io.Writer, template *repoTemplate, order []string) error {
+	var worktrees []serviceWorktree
+	for _, name := range order {
+		repoPath, err := t.servicePath(template, name)
+		if err != nil {
+			return err
+		}
+		if exists, err := pathExists(repoPath); err != nil || !exists {
+			continue
+		}
+		found, err := listWorktrees(ctx, name, repoPath)
+		if err != nil {
+			return err
+		}
+		worktrees = append(worktrees, found...)
+	}
+
+	if len(worktrees) == 0 {
+		fmt.Fprintln(w, "No service worktrees.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tBRANCH\tHEAD\tPATH")
+	for _, wt := range worktrees {
+		fmt.Fprintf(tw, "%s\t%s\t%.7s\t%s\n", wt.Service, wt.Branch, wt.Head, wt.Path)
+	}
+	return tw.Flush()
+}
+
+// worktreePath returns where the worktree for branch lives: next to the clone, named <dir>@<branch>.
+func worktreePath(repoPath, branch string) string {
+	slug := strings.Trim(branchSlugUnsafe.ReplaceAllString(branch, "-"), "-")
+	return repoPath + worktreeSeparator + slug
+}
+
+// newWorktreePath picks the directory for a new worktree of branch. Branches that differ only in
+// characters the slug replaces, such as feature/a and feature-a, would share a directory, so the
+// later one gets a suffix derived from its name. A branch that already has a worktree is refused.
+func newWorktreePath(ctx context.Context, name, repoPath, branch string) (string, error) {
+	worktrees, err := listWorktrees(ctx, name, repoPath)
+	if err != nil {
+		return "", err
+	}
+	taken := make(map[string]string, len(worktrees))
+	for _, wt := range worktrees {
+		if wt.Branch == branch {
+			return "", fmt.Errorf("service %q: branch %s already has a worktree at %s", name, branch, wt.Path)
+		}
+		taken[filepath.Base(wt.Path)] = wt.Branch
+	}
+
+	path := worktreePath(repoPath, branch)
+	if other, ok := taken[filepath.Base(path)]; ok {
+		sum := sha256.Sum256([]byte(branch))
+		path = fmt.Sprintf("%s-%x", path, sum[:4])
+		fmt.Printf("Worktree directory for %s is taken by branch %s; using %s\n", branch, other, path)
+	}
+
+	exists, err := pathExists(path)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("unable to inspect %s: %w", path, err)
+	case exists:
+		return "", fmt.Errorf("%s already exists and is not a worktree of %s; move it out of the way first", path, name)
+	}
+	return path, nil
+}
+
+// listWorktrees returns the worktrees of the clone at repoPath, excluding the clone itself.
+func listWorktrees(ctx context.Context, name, repoPath string) ([]serviceWorktree, error) {
+	out, err := gitOutput(ctx, repoPath, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("service %q: %w", name, err)
+	}
+
+	var worktrees []serviceWorktree
+	for i, block := range strings.Split(out, "\n\n") {
+		if i == 0 {
+			continue // the main worktree is the clone itself
+		}
+		wt := serviceWorktree{Service: name, Branch: "(detached)"}
+		for _, line := range strings.Split(block, "\n") {
+			key, val, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				wt.Path = val
+			case "HEAD":
+				wt.Head = val
+			case "branch":
+				wt.Branch = strings.TrimPrefix(val, "refs/heads/")
+			}
+		}
+		worktrees = append(worktrees, wt)
+	}
+	return worktrees, nil
+}
+
+// offsetPorts adds offset to every numeric environment value of the named service whose key
+// ends in PORT, including values inherited from defaults, and forces them over your shell's
+// values. It returns the keys it changed.
+func (t *repoTemplate) offsetPorts(name string, offset int) ([]string, error) {
+	if offset == 0 {
+		return nil, nil
+	}
+
+	svc := cloneRepoService(t.Services[name])
+	svc.Environment = t.serviceEnvironment(svc)
+
+	var shifted []string
+	for key, val := range svc.Environment {
+		if !strings.HasSuffix(strings.ToUpper(key), "PORT") {
+			continue
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			continue
+		}
+		if port+offset < 1 || port+offset > 65535 {
+			return nil, fmt.Errorf("service %q: %s=%d with offset %+d is not a valid port", name, key, port, offset)
+		}
+		svc.Environment[key] = strconv.Itoa(port + offset)
+		shifted = append(shifted, key)
+	}
+	sort.Strings(shifted)
+	// A port left in your shell from the main clone must not undo the offset.
+	svc.EnvPolicy = svc.EnvPolicy.merge(&envPolicy{Force: shifted})
+
+	t.Services[name] = svc
+	return shifted, nil
+}
+
+// promptLine asks for a single line of input, returning false when it is blank.
+func promptLine(scanner *bufio.Scanner, prompt string) (string, bool) {
+	fmt.Printf("%s (blank to cancel): ", prompt)
+	if !scanner.Scan() {
+		return "", false
+	}
+	answer := strings.TrimSpace(scanner.Text())
+	return answer, answer != ""
+}